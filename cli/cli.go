@@ -5,6 +5,7 @@ import (
 	"os"
 	"fmt"
 	"log"
+	"math"
 )
 
 type CLI struct {
@@ -13,13 +14,24 @@ type CLI struct {
 
 func (cli *CLI) printUsage() {
 	fmt.Println("Usage:")
-	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println("  createblockchain -address ADDRESS -txindex - Create a blockchain and send genesis block reward to ADDRESS. Keep a transaction index, when -txindex is set")
+	fmt.Println("  createmultisig -m M -pubkeys PUBKEY1,PUBKEY2,... - Create an M-of-N multisig address from hex public keys and save it into the wallet file")
 	fmt.Println("  createwallet - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  finddata -data HEX - Find the transactions that recorded data HEX in the main chain")
 	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  gethistory -address ADDRESS - List the transactions that paid to or spent from ADDRESS")
+	fmt.Println("  getproof -txid TXID - Print a Merkle proof that transaction TXID is included in the main chain")
+	fmt.Println("  getreceived -address ADDRESS - Get the total amount ever received by ADDRESS")
+	fmt.Println("  getsupply -height HEIGHT - Get the amount of coins issued up to HEIGHT (the best height by default)")
 	fmt.Println("  listaddresses - Lists all addresses from the wallet file")
+	fmt.Println("  miningstatus - Print the mining state of the running node with ID specified in NODE_ID env. var.")
 	fmt.Println("  printchain - Print all the blocks of the blockchain")
 	fmt.Println("  reindexutxo - Rebuilds the UTXO set")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT -mine - Send AMOUNT of coins from FROM address to TO. Mine on the same node, when -mine is set.")
+	fmt.Println("  reindextx -disable - Builds the transaction index and keeps it updated. Delete the index and stop updating it, when -disable is set")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT -fee FEE -locktime LOCKTIME -data HEX -mine - Send AMOUNT of coins from FROM address to TO, paying FEE to the miner. The transaction is only mined after block height (or Unix time) LOCKTIME, and records data HEX in an unspendable output. Mine on the same node, when -mine is set.")
+	fmt.Println("  signmultisig -from MULTISIG -to TO -amount AMOUNT -fee FEE [-tx HEX] -mine - Sign a payment from a multisig address with the local keys, continuing the partially signed transaction HEX if given. Send it once it has enough signatures")
+	fmt.Println("  startmining - Resume mining on the running node with ID specified in NODE_ID env. var., if it was started with -miner")
+	fmt.Println("  stopmining - Stop mining on the running node with ID specified in NODE_ID env. var.")
 	fmt.Println("  startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
 }
 
@@ -46,28 +58,82 @@ func (cli *CLI) Run() {
 	// 1、设置匹配模板 
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	findDataCmd := flag.NewFlagSet("finddata", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+	getHistoryCmd := flag.NewFlagSet("gethistory", flag.ExitOnError)
+	getProofCmd := flag.NewFlagSet("getproof", flag.ExitOnError)
+	getReceivedCmd := flag.NewFlagSet("getreceived", flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet("getsupply", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	signMultiSigCmd := flag.NewFlagSet("signmultisig", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	miningStatusCmd := flag.NewFlagSet("miningstatus", flag.ExitOnError)
+	startMiningCmd := flag.NewFlagSet("startmining", flag.ExitOnError)
+	stopMiningCmd := flag.NewFlagSet("stopmining", flag.ExitOnError)
 
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	findDataData := findDataCmd.String("data", "", "Hex encoded data to look for")
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	getHistoryAddress := getHistoryCmd.String("address", "", "The address to get history for")
+	getProofTxID := getProofCmd.String("txid", "", "The transaction to prove")
+	getReceivedAddress := getReceivedCmd.String("address", "", "The address to get received amount for")
+	getSupplyHeight := getSupplyCmd.Int("height", -1, "The height to get supply at")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the miner")
+	sendData := sendCmd.String("data", "", "Hex encoded data (at most 80 bytes) to record in the transaction")
+	sendLockTime := sendCmd.Uint("locktime", 0, "Only mine the transaction after this block height (or Unix time, if at least 500000000)")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createBlockchainTxIndex := createBlockchainCmd.Bool("txindex", false, "Keep a transaction index")
+	reindexTxDisable := reindexTxCmd.Bool("disable", false, "Delete the transaction index and stop updating it")
+	createMultiSigM := createMultiSigCmd.Int("m", 0, "Number of signatures required")
+	createMultiSigPubKeys := createMultiSigCmd.String("pubkeys", "", "Comma separated hex public keys")
+	signMultiSigFrom := signMultiSigCmd.String("from", "", "Source multisig address")
+	signMultiSigTo := signMultiSigCmd.String("to", "", "Destination wallet address")
+	signMultiSigAmount := signMultiSigCmd.Int("amount", 0, "Amount to send")
+	signMultiSigFee := signMultiSigCmd.Int("fee", 0, "Fee paid to the miner")
+	signMultiSigTx := signMultiSigCmd.String("tx", "", "Partially signed transaction in hex")
+	signMultiSigMine := signMultiSigCmd.Bool("mine", false, "Mine immediately on the same node")
 	
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
 	
 	// 2、根据第二个输入参数Args[1]进行匹配，匹配成功则继续匹配后续输入内容
 	switch os.Args[1] {
+	case "finddata":
+		err := findDataCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "gethistory":
+		err := getHistoryCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getproof":
+		err := getProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getreceived":
+		err := getReceivedCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getsupply":
+		err := getSupplyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -93,11 +159,54 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "miningstatus":
+		err := miningStatusCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "startmining":
+		err := startMiningCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "stopmining":
+		err := stopMiningCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmultisig":
+		err := signMultiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
 	}
 
+	if findDataCmd.Parsed() {
+		if *findDataData == "" {
+			findDataCmd.Usage()
+			os.Exit(1)
+		}
+		cli.findData(*findDataData, nodeID)
+	}
+
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
@@ -106,23 +215,65 @@ func (cli *CLI) Run() {
 		cli.getBalance(*getBalanceAddress, nodeID)
 	}
 
+	if getHistoryCmd.Parsed() {
+		if *getHistoryAddress == "" {
+			getHistoryCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getHistory(*getHistoryAddress, nodeID)
+	}
+
+	if getProofCmd.Parsed() {
+		if *getProofTxID == "" {
+			getProofCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getProof(*getProofTxID, nodeID)
+	}
+
+	if getReceivedCmd.Parsed() {
+		if *getReceivedAddress == "" {
+			getReceivedCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getReceived(*getReceivedAddress, nodeID)
+	}
+
 	if printChainCmd.Parsed() {
 		cli.printChain(nodeID)
 	}
+	if getSupplyCmd.Parsed() {
+		cli.getSupply(*getSupplyHeight, nodeID)
+	}
 	if createBlockchainCmd.Parsed() {
 		if *createBlockchainAddress == "" {
 			createBlockchainCmd.Usage()
 			os.Exit(1)
 		}
-		cli.createBlockchain(*createBlockchainAddress, nodeID)
+		cli.createBlockchain(*createBlockchainAddress, nodeID, *createBlockchainTxIndex)
 	}
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 || *sendLockTime > math.MaxUint32 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, uint32(*sendLockTime), *sendData, nodeID, *sendMine)
+	}
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigM <= 0 || *createMultiSigPubKeys == "" {
+			createMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createMultiSig(*createMultiSigM, *createMultiSigPubKeys, nodeID)
+	}
+	if signMultiSigCmd.Parsed() {
+		if *signMultiSigFrom == "" || (*signMultiSigTx == "" && (*signMultiSigTo == "" || *signMultiSigAmount <= 0)) || *signMultiSigFee < 0 {
+			signMultiSigCmd.Usage()
+			os.Exit(1)
+		}
+
+		cli.signMultiSig(*signMultiSigFrom, *signMultiSigTo, *signMultiSigAmount, *signMultiSigFee, *signMultiSigTx, nodeID, *signMultiSigMine)
 	}
 	if createWalletCmd.Parsed() {
 		cli.createWallet(nodeID)
@@ -132,6 +283,22 @@ func (cli *CLI) Run() {
 		cli.listAddresses(nodeID)
 	}
 
+	if reindexTxCmd.Parsed() {
+		cli.reindexTx(nodeID, *reindexTxDisable)
+	}
+
+	if miningStatusCmd.Parsed() {
+		cli.miningStatus(nodeID)
+	}
+
+	if startMiningCmd.Parsed() {
+		cli.startMining(nodeID)
+	}
+
+	if stopMiningCmd.Parsed() {
+		cli.stopMining(nodeID)
+	}
+
 	if startNodeCmd.Parsed() {
 		nodeID := os.Getenv("NODE_ID")
 		if nodeID == "" {
@@ -7,15 +7,16 @@ import (
 	"log"
 )
 
-func (cli *CLI) createBlockchain(createBlockchainAddress string, nodeID string) {
+func (cli *CLI) createBlockchain(createBlockchainAddress string, nodeID string, txIndex bool) {
 	if !wallet.ValidateAddress(createBlockchainAddress) {
 		log.Panic("ERROR: Address is not valid")
 	}
 	bc := core.CreateBlockchain(createBlockchainAddress, nodeID)
 	defer bc.DB.Close()
 
-	UTXOSet := core.UTXOSet{bc}
-	UTXOSet.Reindex()
+	if txIndex {
+		bc.ReindexTransactions()
+	}
 
 	fmt.Println("Done!")
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"blockchain/wallet"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// 用逗号分隔的十六进制公钥创建m-of-n多重签名地址，赎回脚本保存到钱包文件中。
+// 每个签名者都要用同样的公钥和顺序创建一次，才能在自己的节点上签名
+func (cli *CLI) createMultiSig(m int, pubKeysHex, nodeID string) {
+	var pubKeys [][]byte
+	for _, item := range strings.Split(pubKeysHex, ",") {
+		pubKey, err := hex.DecodeString(strings.TrimSpace(item))
+		if err != nil {
+			log.Panic(err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	wallets, _ := wallet.NewWallets(nodeID)
+	address, err := wallets.CreateMultiSig(m, pubKeys)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveToFile(nodeID)
+
+	redeemScript, _ := wallets.GetRedeemScript(address)
+	fmt.Printf("Your new %d-of-%d multisig address: %s\n", m, len(pubKeys), address)
+	fmt.Printf("Redeem script: %s\n", redeemScript)
+}
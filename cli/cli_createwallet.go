@@ -9,4 +9,6 @@ func (cli *CLI) createWallet(nodeID string) {
 	wallets.SaveToFile(nodeID)
 
 	fmt.Printf("Your new address: %s\n", address)
+	// 创建多重签名地址时需要公钥
+	fmt.Printf("Public key: %x\n", wallets.GetWallet(address).PublicKey)
 }
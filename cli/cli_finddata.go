@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"blockchain/core"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+func (cli *CLI) findData(dataHex, nodeID string) {
+	data, err := hex.DecodeString(dataHex)
+	if err != nil {
+		log.Panic("ERROR: Data is not valid hex")
+	}
+	bc := core.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	records := bc.FindData(data)
+	if len(records) == 0 {
+		fmt.Printf("Data %x is not recorded in the blockchain\n", data)
+		return
+	}
+
+	fmt.Printf("Data %x is recorded in:\n", data)
+	for _, record := range records {
+		fmt.Printf("  height %d  block %x  time %s  tx %x  output %d\n", record.Height, record.BlockHash,
+			time.Unix(record.Timestamp, 0).UTC().Format(time.RFC3339), record.TxID, record.Vout)
+	}
+}
@@ -13,16 +13,14 @@ func (cli *CLI) getBalance(address, nodeID string) {
 		log.Panic("ERROR: Address is not valid")
 	}
 	bc := core.NewBlockchain(nodeID)
-	UTXOSet := core.UTXOSet{bc}
+	UTXOSet := core.UTXOSet{Blockchain: bc}
 	defer bc.DB.Close()
 
-	balance := 0
 	pubKeyHash := util.Base58Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	UTXOs := UTXOSet.FindUTXO(pubKeyHash)
+	// 未成熟的coinbase输出暂时不能花费，单独列出
+	balance, immature := UTXOSet.GetBalance(pubKeyHash)
 
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
+	fmt.Printf("Immature: %d\n", immature)
 }
\ No newline at end of file
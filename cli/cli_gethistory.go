@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"fmt"
+	"blockchain/core"
+	"log"
+	"blockchain/wallet"
+	"blockchain/util"
+)
+
+func (cli *CLI) getHistory(address, nodeID string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+	bc := core.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	pubKeyHash := util.Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	events := bc.GetAddressHistory(pubKeyHash)
+
+	fmt.Printf("History of '%s':\n", address)
+	for _, event := range events {
+		if event.Spent {
+			fmt.Printf("  height %d  tx %x  input %d   -%d\n", event.Height, event.TxID, event.Index, event.Value)
+		} else {
+			fmt.Printf("  height %d  tx %x  output %d  +%d\n", event.Height, event.TxID, event.Index, event.Value)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"fmt"
+	"blockchain/core"
+	"encoding/hex"
+	"log"
+)
+
+func (cli *CLI) getProof(txID, nodeID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic("ERROR: Transaction ID is not valid")
+	}
+	bc := core.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	proof, err := bc.GetTxProof(ID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Transaction: %x\n", proof.Tx.ID)
+	fmt.Printf("Block: %x\n", proof.BlockHash)
+	fmt.Printf("Height: %d\n", proof.Height)
+	fmt.Printf("Header: %x\n", proof.Header.Serialize())
+	fmt.Printf("Merkle root: %x\n", proof.Header.MerkleRoot)
+	fmt.Printf("Index: %d\n", proof.Proof.Index)
+	for i, sibling := range proof.Proof.Siblings {
+		fmt.Printf("Sibling %d: %x\n", i, sibling)
+	}
+	fmt.Printf("Verified: %t\n", proof.Verify())
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"fmt"
+	"blockchain/core"
+	"log"
+	"blockchain/wallet"
+	"blockchain/util"
+)
+
+func (cli *CLI) getReceived(address, nodeID string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("ERROR: Address is not valid")
+	}
+	bc := core.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	pubKeyHash := util.Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	received := bc.GetReceived(pubKeyHash)
+
+	fmt.Printf("Received by '%s': %d\n", address, received)
+}
@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"fmt"
+	"blockchain/core"
+	"blockchain/transaction"
+)
+
+// 打印到height为止发行的币的总量，height小于0时使用主链当前的高度
+func (cli *CLI) getSupply(height int, nodeID string) {
+	if height < 0 {
+		bc := core.NewBlockchain(nodeID)
+		height = bc.GetBestHeight()
+		bc.DB.Close()
+	}
+
+	fmt.Printf("Supply at height %d: %d\n", height, transaction.TotalSupply(height))
+	fmt.Printf("Subsidy of block %d: %d\n", height+1, transaction.BlockSubsidy(height+1))
+}
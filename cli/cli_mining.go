@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"blockchain/core"
+	"fmt"
+	"log"
+)
+
+func (cli *CLI) miningStatus(nodeID string) {
+	status, err := core.RequestMiningStatus(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printMiningStatus(status)
+}
+
+func (cli *CLI) startMining(nodeID string) {
+	status, err := core.RequestStartMining(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printMiningStatus(status)
+}
+
+func (cli *CLI) stopMining(nodeID string) {
+	status, err := core.RequestStopMining(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	printMiningStatus(status)
+}
+
+func printMiningStatus(status core.MiningStatus) {
+	if status.Address == "" {
+		fmt.Println("Mining is not enabled on this node")
+		return
+	}
+
+	fmt.Printf("Running:      %t\n", status.Running)
+	fmt.Printf("Address:      %s\n", status.Address)
+	fmt.Printf("Height:       %d\n", status.Height)
+	fmt.Printf("Blocks mined: %d\n", status.BlocksMined)
+	fmt.Printf("Hashrate:     %.0f H/s\n", status.Hashrate)
+	if status.LastError != "" {
+		fmt.Printf("Last error:   %s\n", status.LastError)
+	}
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"fmt"
+	"blockchain/core"
+)
+
+func (cli *CLI) reindexTx(nodeID string, disable bool) {
+	bc := core.NewBlockchain(nodeID)
+	defer bc.DB.Close()
+
+	if disable {
+		bc.DisableTxIndex()
+		fmt.Println("Done! Transaction index is disabled.")
+		return
+	}
+
+	bc.ReindexTransactions()
+
+	fmt.Println("Done! Transaction index is enabled.")
+}
@@ -3,21 +3,35 @@ package cli
 import (
 	"fmt"
 	"blockchain/core"
+	"blockchain/script"
 	"blockchain/transaction"
 	"blockchain/wallet"
+	"encoding/hex"
 	"log"
 )
 
-func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
+func (cli *CLI) send(from, to string, amount, fee int, lockTime uint32, dataHex, nodeID string, mineNow bool) {
 	if !wallet.ValidateAddress(from) {
 		log.Panic("ERROR: Sender address is not valid")
 	}
 	if !wallet.ValidateAddress(to) {
 		log.Panic("ERROR: Recipient address is not valid")
 	}
+	// 要记录的数据，为空时交易不包含数据输出
+	var data []byte
+	if dataHex != "" {
+		var err error
+		data, err = hex.DecodeString(dataHex)
+		if err != nil {
+			log.Panic("ERROR: Data is not valid hex")
+		}
+		if len(data) > script.MaxDataSize {
+			log.Panicf("ERROR: Data is longer than %d bytes", script.MaxDataSize)
+		}
+	}
 	// 创建一个新区块
 	bc := core.NewBlockchain(nodeID)
-	utxoset := core.UTXOSet{bc}
+	utxoset := core.UTXOSet{Blockchain: bc}
 
 	defer bc.DB.Close()
 
@@ -28,13 +42,17 @@ func (cli *CLI) send(from, to string, amount int, nodeID string, mineNow bool) {
 	wallet := wallets.GetWallet(from)
 
 	// 创建一个新交易
-	tx := core.NewUTXOTransaction(&wallet, to, amount, &utxoset)
+	tx := core.NewUTXOTransaction(&wallet, to, amount, fee, lockTime, data, &utxoset)
 	if mineNow {
-		cbTx := transaction.NewCoinbaseTX(from, "")
+		err = bc.CheckTransactionLocks(tx)
+		if err != nil {
+			log.Panic(err)
+		}
+		// 在本节点挖矿时，手续费由from自己领取
+		cbTx := transaction.NewCoinbaseTX(from, "", bc.GetBestHeight()+1, fee)
 		txs := []*transaction.Transaction{cbTx, tx}
-		// 将交易打包进区块中，并加入区块链，写入数据库中
-		newBlock := bc.MineBlock(txs)
-		utxoset.Update(newBlock)
+		// 将交易打包进区块中，并加入区块链，写入数据库中，同时更新UTXO集
+		bc.MineBlock(txs)
 	} else {
 		core.SendTx(core.KnownNodes[0], tx)
 	}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"blockchain/core"
+	"blockchain/script"
+	"blockchain/transaction"
+	"blockchain/wallet"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// 从多重签名地址from转账。txHex为空时新建一笔给to发amount个币的交易，否则继续为其他签名者签过的交易txHex签名。
+// 用本地钱包中属于这个多重签名地址的密钥签名，签名足够时发送交易，否则打印交易交给下一个签名者
+func (cli *CLI) signMultiSig(from, to string, amount, fee int, txHex, nodeID string, mineNow bool) {
+	if !wallet.ValidateAddress(from) {
+		log.Panic("ERROR: Sender address is not valid")
+	}
+
+	bc := core.NewBlockchain(nodeID)
+	utxoset := core.UTXOSet{Blockchain: bc}
+	defer bc.DB.Close()
+
+	wallets, err := wallet.NewWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	redeemScript, ok := wallets.GetRedeemScript(from)
+	if !ok {
+		log.Panic("ERROR: Multisig address is not in the wallet file, create it with createmultisig first")
+	}
+	m, _, _ := script.ExtractMultiSig(redeemScript)
+
+	var tx transaction.Transaction
+	if txHex == "" {
+		if !wallet.ValidateAddress(to) {
+			log.Panic("ERROR: Recipient address is not valid")
+		}
+		tx = *core.NewMultiSigTransaction(redeemScript, to, amount, fee, 0, &utxoset)
+	} else {
+		data, err := hex.DecodeString(txHex)
+		if err != nil {
+			log.Panic(err)
+		}
+		tx = transaction.DeserializeTransaction(data)
+	}
+
+	signers := wallets.GetMultiSigSigners(from)
+	if len(signers) == 0 {
+		log.Panic("ERROR: No key of the multisig address is in the wallet file")
+	}
+
+	// 每个输入的签名个数相同，取最少的一个
+	signatures := m
+	for inID := range tx.Vin {
+		count := 0
+		for _, signer := range signers {
+			count, err = tx.SignMultiSig(inID, signer.PrivateKey, redeemScript)
+			if err != nil {
+				log.Panic(err)
+			}
+		}
+		if count < signatures {
+			signatures = count
+		}
+	}
+
+	if signatures < m || !bc.VerifyTransaction(&tx) {
+		fmt.Printf("Signatures: %d of %d\n", signatures, m)
+		fmt.Printf("Pass the transaction to the next signer with -tx %x\n", tx.Serialize())
+		return
+	}
+
+	if mineNow {
+		// 在本节点挖矿时，手续费由from自己领取。继续签名的交易按实际的输入输出计算手续费
+		fee, err = utxoset.TransactionFee(&tx)
+		if err != nil {
+			log.Panic(err)
+		}
+		cbTx := transaction.NewCoinbaseTX(from, "", bc.GetBestHeight()+1, fee)
+		bc.MineBlock([]*transaction.Transaction{cbTx, &tx})
+	} else {
+		core.SendTx(core.KnownNodes[0], &tx)
+	}
+
+	fmt.Println("Success!")
+}
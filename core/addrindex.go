@@ -0,0 +1,204 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"blockchain/util"
+	"fmt"
+	"log"
+)
+
+const addrIndexBucket = "addrindex"
+
+// 地址索引中的一条记录：某笔交易给地址转入（Spent为false）或从地址转出（Spent为true）了Value个币
+type AddrEvent struct {
+	TxID   []byte
+	Height int
+	// 转入时是交易输出的序号，转出时是交易输入的序号
+	Index int
+	Value int
+	Spent bool
+}
+
+// 一个地址的全部记录，按区块高度从低到高排列
+type AddrHistory struct {
+	Events []AddrEvent
+}
+
+// 地址索引中每条记录一个键：地址哈希、区块高度、交易ID、方向、序号，值是金额。
+// 同一地址的记录在桶中相邻，并按区块高度排列；连接区块时只需要写入新的记录，不用重写整个历史
+func addrEventKey(pubKeyHash []byte, event AddrEvent) []byte {
+	var e util.Encoder
+
+	e.WriteBytes(pubKeyHash)
+	e.WriteInt64(int64(event.Height))
+	e.WriteBytes(event.TxID)
+	e.WriteBool(event.Spent)
+	e.WriteInt64(int64(event.Index))
+
+	return e.Bytes()
+}
+
+// 一个地址的所有记录的键的公共前缀
+func addrEventPrefix(pubKeyHash []byte) []byte {
+	var e util.Encoder
+	e.WriteBytes(pubKeyHash)
+
+	return e.Bytes()
+}
+
+// 由记录的键和值还原记录
+func decodeAddrEvent(key, value []byte) (AddrEvent, error) {
+	var event AddrEvent
+
+	d := util.NewDecoder(key)
+	d.ReadBytes()
+	event.Height = int(d.ReadInt64())
+	event.TxID = d.ReadBytes()
+	event.Spent = d.ReadBool()
+	event.Index = int(d.ReadInt64())
+	err := d.Finish()
+	if err != nil {
+		return event, err
+	}
+
+	d = util.NewDecoder(value)
+	event.Value = int(d.ReadInt64())
+
+	return event, d.Finish()
+}
+
+func encodeAddrEventValue(event AddrEvent) []byte {
+	var e util.Encoder
+	e.WriteInt64(int64(event.Value))
+
+	return e.Bytes()
+}
+
+// 返回公钥哈希对应地址的所有转入、转出记录
+func (bc *Blockchain) GetAddressHistory(pubKeyHash []byte) []AddrEvent {
+	var history AddrHistory
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		history = tx.GetAddrHistory(pubKeyHash)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return history.Events
+}
+
+// 返回地址累计收到的币的数量
+func (bc *Blockchain) GetReceived(pubKeyHash []byte) int {
+	received := 0
+
+	for _, event := range bc.GetAddressHistory(pubKeyHash) {
+		if !event.Spent {
+			received += event.Value
+		}
+	}
+
+	return received
+}
+
+// 一条地址记录和它所属的地址哈希
+type addrIndexEntry struct {
+	pubKeyHash []byte
+	event      AddrEvent
+}
+
+// 计算区块中的交易产生的地址记录。spentOutput返回区块之前就存在的被花费的输出，
+// 花费同一区块中前面的交易创建的输出时直接从区块中取得
+func blockAddressEvents(block *Block, spentOutput func(vin transaction.TXInput) (*transaction.TXOutput, error)) ([]addrIndexEntry, error) {
+	var entries []addrIndexEntry
+	created := make(map[string]*transaction.Transaction)
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false {
+			for inIdx, vin := range tx.Vin {
+				var prevOut *transaction.TXOutput
+				if prevTx, inBlock := created[string(vin.Txid)]; inBlock && vin.Vout >= 0 && vin.Vout < len(prevTx.Vout) {
+					prevOut = &prevTx.Vout[vin.Vout]
+				} else {
+					out, err := spentOutput(vin)
+					if err != nil {
+						return nil, err
+					}
+					prevOut = out
+				}
+
+				// 转出记录在被花费输出的地址下，不是P2PKH或P2SH的输出没有地址
+				if pubKeyHash := prevOut.AddressHash(); pubKeyHash != nil {
+					entries = append(entries, addrIndexEntry{pubKeyHash, AddrEvent{tx.ID, block.Height, inIdx, prevOut.Value, true}})
+				}
+			}
+		}
+
+		for outIdx, out := range tx.Vout {
+			if pubKeyHash := out.AddressHash(); pubKeyHash != nil {
+				entries = append(entries, addrIndexEntry{pubKeyHash, AddrEvent{tx.ID, block.Height, outIdx, out.Value, false}})
+			}
+		}
+
+		created[string(tx.ID)] = tx
+	}
+
+	return entries, nil
+}
+
+// 将区块的地址记录写入索引。被花费的输出从UTXO集中取得，因此要在更新UTXO集之前、在同一个存储事务中调用
+func indexAddresses(tx StoreTx, block *Block) error {
+	entries, err := blockAddressEvents(block, func(vin transaction.TXInput) (*transaction.TXOutput, error) {
+		entry := tx.GetUTXO(vin.Txid, vin.Vout)
+		if entry == nil {
+			return nil, fmt.Errorf("%w: %x:%d", ErrMissingInput, vin.Txid, vin.Vout)
+		}
+
+		return &entry.Output, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := tx.PutAddrEvent(entry.pubKeyHash, entry.event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 从索引中删除区块的地址记录。被花费的输出从区块的撤销数据中取得，因此要在回滚UTXO集之前调用
+func unindexAddresses(tx StoreTx, block *Block) error {
+	spent := make(map[string]*transaction.TXOutput)
+	if undo := tx.GetUndo(block.Hash); undo != nil {
+		for i := range undo.Spent {
+			spent[string(outpointKey(undo.Spent[i].TxID, undo.Spent[i].Vout))] = &undo.Spent[i].Entry.Output
+		}
+	}
+
+	entries, err := blockAddressEvents(block, func(vin transaction.TXInput) (*transaction.TXOutput, error) {
+		out, ok := spent[string(outpointKey(vin.Txid, vin.Vout))]
+		if !ok {
+			return nil, fmt.Errorf("%w: %x:%d has no undo data", ErrMissingInput, vin.Txid, vin.Vout)
+		}
+
+		return out, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := tx.DeleteAddrEvent(entry.pubKeyHash, entry.event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
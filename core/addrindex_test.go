@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"blockchain/transaction"
+	"blockchain/wallet"
+)
+
+func TestAddressHistoryAndReceived(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+	defer func() { mempool = make(map[string]transaction.Transaction) }()
+
+	other := wallet.NewWallet()
+	otherAddress := fmt.Sprintf("%s", other.GetAddress())
+	pubKeyHash := wallet.HashPubKey(w.PublicKey)
+	otherPubKeyHash := wallet.HashPubKey(other.PublicKey)
+
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subsidy := transaction.BlockSubsidy(0)
+
+	u := UTXOSet{bc}
+	tx := NewUTXOTransaction(w, otherAddress, 3, 1, 0, nil, &u)
+	block := mineOn(t, bc, &genesis, otherAddress, tx)
+	mustAddBlock(t, bc, block)
+
+	// 创世区块的奖励转入，区块1中全部转出并找零。同一交易中转入的记录排在转出之前
+	want := []AddrEvent{
+		{genesis.Transactions[0].ID, 0, 0, subsidy, false},
+		{tx.ID, 1, 1, subsidy - 4, false},
+		{tx.ID, 1, 0, subsidy, true},
+	}
+	history := bc.GetAddressHistory(pubKeyHash)
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v, want %+v", history, want)
+	}
+	for i := range want {
+		got := history[i]
+		if !bytes.Equal(got.TxID, want[i].TxID) || got.Height != want[i].Height || got.Index != want[i].Index || got.Value != want[i].Value || got.Spent != want[i].Spent {
+			t.Fatalf("history[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if got := bc.GetReceived(pubKeyHash); got != subsidy+subsidy-4 {
+		t.Fatalf("GetReceived() = %d, want %d", got, subsidy+subsidy-4)
+	}
+
+	// 收款方收到转账和区块1的coinbase（mineOn的coinbase不领取手续费）
+	if got, want := bc.GetReceived(otherPubKeyHash), 3+transaction.BlockSubsidy(1); got != want {
+		t.Fatalf("GetReceived(other) = %d, want %d", got, want)
+	}
+
+	// 区块1被更重的分支替换后，它的记录从索引中删除
+	b1 := mineOn(t, bc, &genesis, address)
+	mustAddBlock(t, bc, b1)
+	mustAddBlock(t, bc, mineOn(t, bc, b1, address))
+
+	for _, event := range bc.GetAddressHistory(pubKeyHash) {
+		if bytes.Equal(event.TxID, tx.ID) {
+			t.Fatalf("event %+v of the detached block is still indexed", event)
+		}
+	}
+	if got := bc.GetReceived(otherPubKeyHash); got != 0 {
+		t.Fatalf("GetReceived(other) after reorganization = %d, want 0", got)
+	}
+}
+
+func TestBlockAddressEventsSpendingInBlockOutput(t *testing.T) {
+	w := wallet.NewWallet()
+	address := fmt.Sprintf("%s", w.GetAddress())
+	pubKeyHash := wallet.HashPubKey(w.PublicKey)
+
+	previous := transaction.TXInput{Txid: []byte("previous"), Vout: 0}
+	first := &transaction.Transaction{
+		ID:   []byte("first"),
+		Vin:  []transaction.TXInput{previous},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(7, address)},
+	}
+	second := &transaction.Transaction{
+		ID:   []byte("second"),
+		Vin:  []transaction.TXInput{{Txid: first.ID, Vout: 0}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(6, address)},
+	}
+	block := &Block{Transactions: []*transaction.Transaction{first, second}, Height: 5}
+
+	// 只有区块之前存在的输出需要查询，区块中创建的输出直接从区块中取得
+	entries, err := blockAddressEvents(block, func(vin transaction.TXInput) (*transaction.TXOutput, error) {
+		if !bytes.Equal(vin.Txid, previous.Txid) {
+			t.Fatalf("looked up %x, which is created in the block", vin.Txid)
+		}
+
+		return transaction.NewTXOutput(8, address), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AddrEvent{
+		{first.ID, 5, 0, 8, true},
+		{first.ID, 5, 0, 7, false},
+		{second.ID, 5, 0, 7, true},
+		{second.ID, 5, 0, 6, false},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d events, want %d", len(entries), len(want))
+	}
+	for i, entry := range entries {
+		if !bytes.Equal(entry.pubKeyHash, pubKeyHash) || !bytes.Equal(entry.event.TxID, want[i].TxID) || entry.event.Value != want[i].Value || entry.event.Spent != want[i].Spent {
+			t.Fatalf("event %d = %+v, want %+v", i, entry.event, want[i])
+		}
+	}
+}
@@ -1,55 +1,112 @@
 package core
 
 import (
-	"time"
-	"bytes"
-	"encoding/gob"
+	"context"
+	"fmt"
 	"log"
 	"blockchain/transaction"
+	"blockchain/util"
 )
 
+// 区块的规范二进制编码的版本号，编码格式改变时加1
+const BlockEncodingVersion = 3
+
+// 区块头的字段（PrevBlockHash、Timestamp、Nonce、Bits等）可以直接通过区块访问
 type Block struct {
-	Timestamp int64
+	BlockHeader
 	Transactions []*transaction.Transaction
-	PrevBlockHash []byte
 	Hash []byte
-	Nonce int
 	Height int
 }
 
-func NewBlock(transactions []*transaction.Transaction, prevBlockHash []byte,  height int) *Block {
-	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0, height}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
-	block.Hash = hash[:]
-	block.Nonce = nonce
+func NewBlock(transactions []*transaction.Transaction, prevBlockHash []byte,  height int, bits uint32, timestamp int64) *Block {
+	block := newUnminedBlock(transactions, prevBlockHash, height, bits, timestamp)
+	err := DefaultMiner.Mine(context.Background(), block)
+	if err != nil {
+		log.Panic(err)
+	}
 	return block
 }
 
-// Serialize serializes the block
+// Serialize serializes the block with the canonical binary encoding, used for storage and the wire
 func (b *Block) Serialize() []byte {
-	var result bytes.Buffer
-	encoder := gob.NewEncoder(&result)
+	var e util.Encoder
+	b.Encode(&e)
 
-	err := encoder.Encode(b)
+	return e.Bytes()
+}
+
+// DeserializeBlock deserializes a block read from the local store. It panics on malformed data
+func DeserializeBlock(d []byte) *Block {
+	block, err := ParseBlock(d)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return result.Bytes()
+	return block
 }
 
-// DeserializeBlock deserializes a block
-func DeserializeBlock(d []byte) *Block {
-	var block Block
+// ParseBlock deserializes a block received from a peer, returning an error on malformed data
+func ParseBlock(d []byte) (*Block, error) {
+	decoder := util.NewDecoder(d)
 
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
+	block, err := DecodeBlock(decoder)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	return &block
+	return block, decoder.Finish()
+}
+
+// Encode 写入区块：版本号、区块头、区块哈希、高度、交易列表
+func (b *Block) Encode(e *util.Encoder) {
+	e.WriteUint32(BlockEncodingVersion)
+	b.BlockHeader.Encode(e)
+	e.WriteBytes(b.Hash)
+	e.WriteInt64(int64(b.Height))
+
+	e.WriteUint32(uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		tx.Encode(e)
+	}
+}
+
+// DecodeBlock 读取Encode写入的区块，版本号不支持时出错
+func DecodeBlock(d *util.Decoder) (*Block, error) {
+	block := &Block{}
+
+	version := d.ReadUint32()
+	if d.Err() == nil && version != BlockEncodingVersion {
+		return nil, fmt.Errorf("block: unsupported encoding version %d", version)
+	}
+	header, err := DecodeBlockHeader(d)
+	if err != nil {
+		return nil, err
+	}
+	block.BlockHeader = header
+	block.Hash = d.ReadBytes()
+	block.Height = int(d.ReadInt64())
+
+	// 每笔交易至少有版本号、交易ID的长度、两个列表的长度和锁定时间
+	txCount := d.ReadCount(20)
+	for i := 0; i < txCount; i++ {
+		tx, err := transaction.DecodeTransaction(d)
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+
+	if d.Err() != nil {
+		return nil, d.Err()
+	}
+
+	return block, nil
+}
+
+// 返回区块头的副本
+func (b *Block) Header() BlockHeader {
+	return b.BlockHeader
 }
 
 // 遍历所有交易，对每一笔交易ID，计算哈希
@@ -64,6 +121,6 @@ func (b *Block) HashTransactions() []byte {
     return mTree.RootNode.Data
 }
 
-func NewGenesisBlock(coinbase *transaction.Transaction) *Block {
-	return NewBlock([]*transaction.Transaction{coinbase}, []byte{}, 0)
+func NewGenesisBlock(coinbase *transaction.Transaction, timestamp int64) *Block {
+	return NewBlock([]*transaction.Transaction{coinbase}, []byte{}, 0, genesisBits(), timestamp)
 }
\ No newline at end of file
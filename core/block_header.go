@@ -0,0 +1,104 @@
+package core
+
+import (
+	"blockchain/util"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+)
+
+const headerBucket = "headers"
+
+// 区块头的版本号
+const BlockVersion = 1
+
+// BlockHeader 是区块头。区块哈希只对区块头计算，交易通过MerkleRoot与区块头绑定，
+// 因此只有区块头也可以验证工作量证明和区块之间的链接
+type BlockHeader struct {
+	Version       uint32
+	PrevBlockHash []byte
+	// 区块中所有交易的Merkle树根
+	MerkleRoot []byte
+	Timestamp  int64
+	// 压缩格式的难度目标
+	Bits uint32
+	// 编码在区块头的最后4个字节，挖矿时只需修改这4个字节
+	Nonce uint32
+}
+
+// Encode 按规范二进制编码写入区块头的各个字段
+func (h BlockHeader) Encode(e *util.Encoder) {
+	e.WriteUint32(h.Version)
+	e.WriteBytes(h.PrevBlockHash)
+	e.WriteBytes(h.MerkleRoot)
+	e.WriteInt64(h.Timestamp)
+	e.WriteUint32(h.Bits)
+	e.WriteUint32(h.Nonce)
+}
+
+// DecodeBlockHeader 读取Encode写入的区块头，版本号不支持时出错
+func DecodeBlockHeader(d *util.Decoder) (BlockHeader, error) {
+	var h BlockHeader
+
+	h.Version = d.ReadUint32()
+	if d.Err() == nil && h.Version != BlockVersion {
+		return h, fmt.Errorf("block header: unsupported version %d", h.Version)
+	}
+	h.PrevBlockHash = d.ReadBytes()
+	h.MerkleRoot = d.ReadBytes()
+	h.Timestamp = d.ReadInt64()
+	h.Bits = d.ReadUint32()
+	h.Nonce = d.ReadUint32()
+
+	return h, d.Err()
+}
+
+// Serialize serializes the block header
+func (h BlockHeader) Serialize() []byte {
+	var e util.Encoder
+	h.Encode(&e)
+
+	return e.Bytes()
+}
+
+// DeserializeBlockHeader deserializes a block header
+func DeserializeBlockHeader(data []byte) BlockHeader {
+	d := util.NewDecoder(data)
+
+	h, err := DecodeBlockHeader(d)
+	if err == nil {
+		err = d.Finish()
+	}
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return h
+}
+
+// 区块哈希：区块头编码的SHA-256
+func (h BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+// GetHeader finds a block header by the block hash and returns it
+func (bc *Blockchain) GetHeader(blockHash []byte) (BlockHeader, error) {
+	var header BlockHeader
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		headerInDb := tx.GetHeader(blockHash)
+
+		if headerInDb == nil {
+			return errors.New("Block header is not found.")
+		}
+
+		header = *headerInDb
+
+		return nil
+	})
+
+	return header, err
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// 区块中所有交易序列化后的字节数上限，包括coinbase交易。这是共识规则，超过上限的区块会被拒绝
+var MaxBlockSize = 100000
+
+// 交易池中等待打包的交易及其手续费
+type txCandidate struct {
+	tx   *transaction.Transaction
+	fee  int
+	size int
+}
+
+// 手续费率：每字节支付的手续费
+func (c txCandidate) feeRate() float64 {
+	return float64(c.fee) / float64(c.size)
+}
+
+// TransactionFee returns the fee paid by tx: the value of the outputs it spends minus the value of its outputs.
+// Every input must be in the UTXO set, so it fails for a transaction spending an output of another unconfirmed transaction
+func (u UTXOSet) TransactionFee(tx *transaction.Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	var err error
+	inputValue := 0
+	for _, vin := range tx.Vin {
+		entry := u.GetEntry(vin.Txid, vin.Vout)
+		if entry == nil {
+			return 0, fmt.Errorf("%w: %x:%d", ErrMissingInput, vin.Txid, vin.Vout)
+		}
+		inputValue, err = addMoney(inputValue, entry.Output.Value)
+		if err != nil {
+			return 0, fmt.Errorf("%w: inputs of transaction %x", err, tx.ID)
+		}
+	}
+
+	outputValue := 0
+	for _, out := range tx.Vout {
+		if out.Value < 0 {
+			return 0, fmt.Errorf("%w: transaction %x", ErrNegativeOutput, tx.ID)
+		}
+		outputValue, err = addMoney(outputValue, out.Value)
+		if err != nil {
+			return 0, fmt.Errorf("%w: outputs of transaction %x", err, tx.ID)
+		}
+	}
+
+	if outputValue > inputValue {
+		return 0, fmt.Errorf("%w: transaction %x spends %d, outputs %d", ErrOutputsExceedInputs, tx.ID, inputValue, outputValue)
+	}
+
+	return inputValue - outputValue, nil
+}
+
+// CheckMempoolTransaction checks that tx can be mined in the next block and returns its fee.
+// 交易池只接受通过检查的交易：不是coinbase交易，格式正确，输入都在UTXO集中且已经成熟，
+// 输入金额不小于输出金额，锁定时间已到，签名有效。这样区块模板中不会出现使区块验证失败的交易
+func (bc *Blockchain) CheckMempoolTransaction(tx *transaction.Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, fmt.Errorf("%w: transaction %x", ErrLooseCoinbase, tx.ID)
+	}
+
+	err := checkTxSanity(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if !txIDMatches(tx) {
+		return 0, fmt.Errorf("%w: transaction %x", ErrBadTxID, tx.ID)
+	}
+
+	UTXOSet := UTXOSet{bc}
+	fee, err := UTXOSet.TransactionFee(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	tip, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		log.Panic(err)
+	}
+	if UTXOSet.spendsImmatureCoinbase(tx, tip.Height+1) {
+		return 0, fmt.Errorf("%w: transaction %x", ErrImmatureCoinbase, tx.ID)
+	}
+
+	err = bc.checkNextBlockLocks(tx, tip.Height+1, bc.medianTimePast(&tip))
+	if err != nil {
+		return 0, err
+	}
+
+	// 输入都在UTXO集中，FindTransaction一定能找到被花费的交易
+	if !bc.VerifyTransaction(tx) {
+		return 0, fmt.Errorf("%w: transaction %x", ErrInvalidSignature, tx.ID)
+	}
+
+	return fee, nil
+}
+
+// 交易是否花费了在高度为height的区块中还不能花费的coinbase输出
+func (u UTXOSet) spendsImmatureCoinbase(tx *transaction.Transaction, height int) bool {
+	for _, vin := range tx.Vin {
+		entry := u.GetEntry(vin.Txid, vin.Vout)
+		if entry != nil && !entry.IsMature(height) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 从待打包的交易中挑选交易组成新区块，返回的交易列表第一笔是给minerAddress的coinbase交易。
+// 交易按手续费率从高到低加入，区块大小超过MaxBlockSize的交易跳过；
+// 输入不在UTXO集中、花费未成熟的coinbase输出、没有输入或输出、数据输出不合规则、锁定时间未到、签名无效或与已选交易花费同一输出的交易不会被打包。
+// 花费交易池中另一笔交易的输出的交易（链式交易）也因为输入不在UTXO集中而跳过，要等父交易被打包进区块后的下一个区块才能打包
+func (bc *Blockchain) NewBlockTemplate(txs []*transaction.Transaction, minerAddress string) []*transaction.Transaction {
+	UTXOSet := UTXOSet{bc}
+	tip, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		log.Panic(err)
+	}
+	height := tip.Height + 1
+	medianTime := bc.medianTimePast(&tip)
+	var candidates []txCandidate
+
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		fee, err := UTXOSet.TransactionFee(tx)
+		if err != nil || UTXOSet.spendsImmatureCoinbase(tx, height) {
+			continue
+		}
+
+		if checkTxSanity(tx) != nil || bc.checkNextBlockLocks(tx, height, medianTime) != nil {
+			continue
+		}
+
+		candidates = append(candidates, txCandidate{tx, fee, tx.Size()})
+	}
+
+	// 手续费率相同时按交易ID排序，保证结果确定
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].feeRate() != candidates[j].feeRate() {
+			return candidates[i].feeRate() > candidates[j].feeRate()
+		}
+
+		return bytes.Compare(candidates[i].tx.ID, candidates[j].tx.ID) < 0
+	})
+
+	// 为coinbase交易预留空间，按领取全部手续费时的大小计算
+	maxFees := 0
+	for _, c := range candidates {
+		maxFees += c.fee
+	}
+	blockSize := transaction.NewCoinbaseTX(minerAddress, "", height, maxFees).Size()
+	spent := make(map[string]bool)
+	var selected []*transaction.Transaction
+	fees := 0
+
+Candidates:
+	for _, c := range candidates {
+		if blockSize+c.size > MaxBlockSize {
+			continue
+		}
+
+		for _, vin := range c.tx.Vin {
+			if spent[fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)] {
+				continue Candidates
+			}
+		}
+
+		if !bc.VerifyTransaction(c.tx) {
+			continue
+		}
+
+		for _, vin := range c.tx.Vin {
+			spent[fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)] = true
+		}
+
+		selected = append(selected, c.tx)
+		blockSize += c.size
+		fees += c.fee
+	}
+
+	cbTx := transaction.NewCoinbaseTX(minerAddress, "", height, fees)
+
+	return append([]*transaction.Transaction{cbTx}, selected...)
+}
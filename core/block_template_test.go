@@ -0,0 +1,86 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"blockchain/transaction"
+)
+
+func TestCheckMempoolTransaction(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+
+	u := UTXOSet{bc}
+	tx := NewUTXOTransaction(w, address, 3, 2, 0, nil, &u)
+
+	fee, err := bc.CheckMempoolTransaction(tx)
+	if err != nil {
+		t.Fatalf("CheckMempoolTransaction() = %v", err)
+	}
+	if fee != 2 {
+		t.Fatalf("fee = %d, want 2", fee)
+	}
+
+	// 解锁脚本不参与交易ID的计算，篡改签名后交易ID不变
+	forged := *tx
+	forged.Vin = append([]transaction.TXInput(nil), tx.Vin...)
+	forged.Vin[0].ScriptSig = append([]byte(nil), tx.Vin[0].ScriptSig...)
+	forged.Vin[0].ScriptSig[5] ^= 0xff
+
+	missing := *tx
+	missing.Vin = []transaction.TXInput{{Txid: []byte("missing"), Vout: 0, Sequence: transaction.MaxSequence}}
+	trimmed := missing.TrimmedCopy()
+	missing.ID = trimmed.Hash()
+
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+
+	tests := []struct {
+		name string
+		tx   *transaction.Transaction
+		want error
+	}{
+		{"coinbase", coinbase, ErrLooseCoinbase},
+		{"bad signature", &forged, ErrInvalidSignature},
+		{"missing input", &missing, ErrMissingInput},
+	}
+
+	for _, test := range tests {
+		if _, err := bc.CheckMempoolTransaction(test.tx); !errors.Is(err, test.want) {
+			t.Errorf("%s: CheckMempoolTransaction() = %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// 创世区块的coinbase输出还没有成熟
+	CoinbaseMaturity = 10
+	if _, err := bc.CheckMempoolTransaction(tx); !errors.Is(err, ErrImmatureCoinbase) {
+		t.Errorf("immature: CheckMempoolTransaction() = %v, want %v", err, ErrImmatureCoinbase)
+	}
+}
+
+func TestHandleTxRejectsInvalidTransactions(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+	defer func() { mempool = make(map[string]transaction.Transaction) }()
+
+	u := UTXOSet{bc}
+	spend := NewUTXOTransaction(w, address, 3, 1, 0, nil, &u)
+
+	forged := *spend
+	forged.Vin = append([]transaction.TXInput(nil), spend.Vin...)
+	forged.Vin[0].ScriptSig = append([]byte(nil), spend.Vin[0].ScriptSig...)
+	forged.Vin[0].ScriptSig[5] ^= 0xff
+
+	handleRequest(t, bc, append(commandToBytes("tx"), gobEncode(tx{"peer", forged.Serialize()})...))
+	if len(mempool) != 0 {
+		t.Fatal("a transaction with an invalid signature entered the mempool")
+	}
+
+	handleRequest(t, bc, append(commandToBytes("tx"), gobEncode(tx{"peer", spend.Serialize()})...))
+	if _, ok := mempool[hex.EncodeToString(spend.ID)]; !ok {
+		t.Fatal("a valid transaction was not accepted")
+	}
+}
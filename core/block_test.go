@@ -0,0 +1,163 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"blockchain/util"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testBlock(t *testing.T) *Block {
+	t.Helper()
+
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+
+	u := UTXOSet{bc}
+	tx := NewUTXOTransaction(w, address, 3, 1, 0, []byte("data"), &u)
+
+	return bc.MineBlock(bc.NewBlockTemplate([]*transaction.Transaction{tx}, address))
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	block := testBlock(t)
+	data := block.Serialize()
+
+	got, err := ParseBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 规范编码：解码后再编码得到同样的字节
+	if !bytes.Equal(got.Serialize(), data) || got.Height != block.Height || len(got.Transactions) != len(block.Transactions) {
+		t.Fatalf("decoded %+v, want %+v", got, block)
+	}
+	if !bytes.Equal(got.Header().Hash(), block.Hash) || !bytes.Equal(got.HashTransactions(), block.MerkleRoot) {
+		t.Fatal("block hash or Merkle root changed after round trip")
+	}
+}
+
+func TestBlockHeaderRoundTrip(t *testing.T) {
+	header := testBlock(t).Header()
+
+	if got := DeserializeBlockHeader(header.Serialize()); !reflect.DeepEqual(got, header) {
+		t.Fatalf("decoded %+v, want %+v", got, header)
+	}
+}
+
+// 区块哈希只对区块头计算：交易只通过MerkleRoot影响哈希，工作量证明只用区块头就能验证
+func TestBlockHashCoversOnlyHeader(t *testing.T) {
+	block := testBlock(t)
+
+	if !bytes.Equal(block.Header().Hash(), block.Hash) {
+		t.Fatalf("header hash = %x, want block hash %x", block.Header().Hash(), block.Hash)
+	}
+	if !NewProofOfWork(&Block{BlockHeader: block.Header(), Hash: block.Hash}).Validate() {
+		t.Fatal("proof of work does not validate from the header alone")
+	}
+
+	// 换掉交易但不改区块头，哈希不变，但Merkle树根不再匹配
+	tampered := *block
+	tampered.Transactions = block.Transactions[:1]
+	if !bytes.Equal(tampered.Header().Hash(), block.Hash) {
+		t.Fatal("transactions changed the header hash")
+	}
+	if err := checkBlockTransactions(&tampered); !errors.Is(err, ErrBadMerkleRoot) {
+		t.Fatalf("checkBlockTransactions() = %v, want %v", err, ErrBadMerkleRoot)
+	}
+
+	// 区块头的每个字段都影响哈希
+	header := block.Header()
+	changes := []func(h *BlockHeader){
+		func(h *BlockHeader) { h.PrevBlockHash = bytes.Repeat([]byte{1}, 32) },
+		func(h *BlockHeader) { h.MerkleRoot = bytes.Repeat([]byte{1}, 32) },
+		func(h *BlockHeader) { h.Timestamp++ },
+		func(h *BlockHeader) { h.Bits++ },
+		func(h *BlockHeader) { h.Nonce++ },
+	}
+	for i, change := range changes {
+		changed := header
+		change(&changed)
+		if bytes.Equal(changed.Hash(), block.Hash) {
+			t.Errorf("change %d did not change the header hash", i)
+		}
+	}
+}
+
+// 主链和侧链的区块都在headers桶中保存区块头
+func TestHeadersBucket(t *testing.T) {
+	bc, genesis, _, address := newReorgTestChain(t)
+	mainBlock := mineOn(t, bc, genesis, address)
+	mustAddBlock(t, bc, mainBlock)
+	mustAddBlock(t, bc, mineOn(t, bc, mainBlock, address))
+	side := mineOn(t, bc, genesis, address)
+	mustAddBlock(t, bc, side)
+
+	for _, block := range []*Block{genesis, mainBlock, side} {
+		header, err := bc.GetHeader(block.Hash)
+		if err != nil {
+			t.Fatalf("GetHeader(%x) = %v", block.Hash, err)
+		}
+		if !reflect.DeepEqual(header, block.Header()) || !bytes.Equal(header.Hash(), block.Hash) {
+			t.Fatalf("GetHeader(%x) = %+v, want %+v", block.Hash, header, block.Header())
+		}
+	}
+	if _, err := bc.GetHeader([]byte("missing")); err == nil {
+		t.Fatal("GetHeader() of an unknown block succeeded")
+	}
+}
+
+func TestDecodeBlockMalformed(t *testing.T) {
+	data := testBlock(t).Serialize()
+
+	for n := 0; n < len(data); n++ {
+		if _, err := ParseBlock(data[:n]); !errors.Is(err, util.ErrShortData) {
+			t.Fatalf("%d of %d bytes: error = %v, want %v", n, len(data), err, util.ErrShortData)
+		}
+	}
+
+	if _, err := ParseBlock(append(data, 0)); !errors.Is(err, util.ErrTrailingData) {
+		t.Fatalf("trailing byte: error = %v, want %v", err, util.ErrTrailingData)
+	}
+
+	// 交易个数远超剩余数据
+	var e util.Encoder
+	e.WriteUint32(BlockEncodingVersion)
+	BlockHeader{Version: BlockVersion}.Encode(&e)
+	e.WriteBytes(nil)
+	e.WriteInt64(1)
+	e.WriteUint32(0xffffffff)
+	if _, err := ParseBlock(e.Bytes()); !errors.Is(err, util.ErrShortData) {
+		t.Fatalf("oversized count: error = %v, want %v", err, util.ErrShortData)
+	}
+}
+
+func TestIndexRecordsRoundTrip(t *testing.T) {
+	output := transaction.TXOutput{Value: 5, ScriptPubKey: []byte{0x76, 0xa9}}
+	entry := UTXOEntry{output, 12, true}
+	if got := DeserializeUTXOEntry(entry.Serialize()); !reflect.DeepEqual(got, entry) {
+		t.Errorf("UTXOEntry decoded %+v, want %+v", got, entry)
+	}
+
+	undo := BlockUndo{[]SpentOutput{{[]byte{1, 2}, 0, entry}, {[]byte{3}, 4, UTXOEntry{output, 0, false}}}}
+	if got := DeserializeBlockUndo(undo.Serialize()); !reflect.DeepEqual(got, undo) {
+		t.Errorf("BlockUndo decoded %+v, want %+v", got, undo)
+	}
+	if got := DeserializeBlockUndo(BlockUndo{}.Serialize()); len(got.Spent) != 0 {
+		t.Errorf("empty BlockUndo decoded %+v", got)
+	}
+
+	loc := TxLocation{[]byte{9, 9}, 3}
+	if got := DeserializeTxLocation(loc.Serialize()); !reflect.DeepEqual(got, loc) {
+		t.Errorf("TxLocation decoded %+v, want %+v", got, loc)
+	}
+
+	for _, event := range []AddrEvent{{[]byte{1}, 2, 0, 10, false}, {[]byte{3}, 4, 1, 10, true}} {
+		got, err := decodeAddrEvent(addrEventKey([]byte{7, 7}, event), encodeAddrEventValue(event))
+		if err != nil || !reflect.DeepEqual(got, event) {
+			t.Errorf("AddrEvent decoded %+v, %v, want %+v", got, err, event)
+		}
+	}
+}
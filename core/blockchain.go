@@ -1,13 +1,15 @@
 package core
 
 import (
-	"github.com/boltdb/bolt"
+	"context"
 	"log"
 	"blockchain/transaction"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"blockchain/wallet"
+	"blockchain/script"
+	"blockchain/util"
 	"bytes"
 	"crypto/ecdsa"
 	"errors"
@@ -15,39 +17,261 @@ import (
 
 const dbFile = "blockchain_%s.db"
 const blocksBucket = "blocks"
+const chainWorkBucket = "chainwork"
+const heightBucket = "heights"
 const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
 
 type Blockchain struct {
 	// tip：数据库中存储的最后一个区块的哈希
 	Tip []byte
-	DB *bolt.DB
+	DB Store
+	// 节点的时间，用于验证区块时间戳和生成新区块的时间戳。默认为AdjustedTime，测试时可以替换为固定的时间
+	Clock TimeSource
+	// 切换主链时验证失败而被删除的区块，再次收到时直接拒绝
+	invalid map[string]bool
 }
 
-func (bc *Blockchain) AddBlock(block *Block) {
-	err := bc.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockInDb := b.Get(block.Hash)
+// 验证并保存一个区块。区块所在分支的累计工作量超过当前主链时，切换到该分支
+func (bc *Blockchain) AddBlock(block *Block) error {
+	var extendsTip, reorganize bool
 
-		if blockInDb != nil {
+	if _, err := bc.GetBlock(block.Hash); err == nil {
+		return nil
+	}
+
+	// 无效区块的后代也是无效的
+	if bc.invalid[string(block.Hash)] || bc.invalid[string(block.PrevBlockHash)] {
+		bc.markInvalid(block)
+		return fmt.Errorf("%w: block %x", ErrInvalidBlock, block.Hash)
+	}
+
+	err := bc.ValidateBlock(block)
+	if err != nil {
+		return err
+	}
+
+	err = bc.DB.Update(func(tx StoreTx) error {
+		// 累计工作量 = 父区块的累计工作量 + 本区块的工作量
+		work := tx.GetChainWork(block.PrevBlockHash)
+		work.Add(work, NewProofOfWork(block).Work())
+
+		err := tx.PutBlock(block)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		err = tx.PutChainWork(block.Hash, work)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		lastHash := tx.GetTip()
+		lastWork := tx.GetChainWork(lastHash)
+
+		// 工作量不超过主链的区块只保存下来，作为侧链
+		if work.Cmp(lastWork) <= 0 {
 			return nil
 		}
 
-		blockData := block.Serialize()
-		err := b.Put(block.Hash, blockData)
+		if bytes.Compare(block.PrevBlockHash, lastHash) == 0 {
+			extendsTip = true
+		} else {
+			reorganize = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if extendsTip {
+		bc.connectBlock(block)
+	}
+	if reorganize {
+		return bc.reorganize(block)
+	}
+
+	return nil
+}
+
+// 将主链切换到以block结尾的分支：根据撤销数据回滚旧分支上分叉点之后的区块，再依次连接新分支上的区块。
+// 新分支上有区块的交易输入无效时，删除并记住无效的区块，恢复原来的主链和交易池
+func (bc *Blockchain) reorganize(block *Block) error {
+	detach, attach := bc.findFork(block)
+
+	log.Printf("Reorganizing: %d block(s) detached, %d block(s) attached\n", len(detach), len(attach))
+
+	savedMempool := make(map[string]transaction.Transaction, len(mempool))
+	for id, tx := range mempool {
+		savedMempool[id] = tx
+	}
+
+	for _, b := range detach {
+		bc.disconnectBlock(b)
+	}
+
+	for i, b := range attach {
+		err := bc.checkBlockInputs(b)
+		if err == nil {
+			bc.connectBlock(b)
+			continue
+		}
+
+		log.Printf("Reorganization failed at block %x: %s\n", b.Hash, err)
+		for _, invalid := range attach[i:] {
+			bc.markInvalid(invalid)
+		}
+		bc.removeBlocks(attach[i:])
+		// 新分支上已经连接的区块只回滚链状态，它们的交易不放回交易池
+		for j := i - 1; j >= 0; j-- {
+			bc.detachBlock(attach[j])
+		}
+		for j := len(detach) - 1; j >= 0; j-- {
+			bc.connectBlock(detach[j])
+		}
+		mempool = savedMempool
+
+		return err
+	}
+
+	return nil
+}
+
+// 找到当前主链与block所在分支的分叉点。
+// detach：主链上分叉点之后的区块，从tip开始；attach：新分支上分叉点之后的区块，从分叉点开始
+func (bc *Blockchain) findFork(block *Block) ([]*Block, []*Block) {
+	var detach, attach []*Block
+
+	oldBlock, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		log.Panic(err)
+	}
+	oldTip := &oldBlock
+	newTip := block
+
+	for bytes.Compare(oldTip.Hash, newTip.Hash) != 0 {
+		if oldTip.Height >= newTip.Height {
+			detach = append(detach, oldTip)
+			oldTip = bc.parentOf(oldTip)
+		} else {
+			attach = append([]*Block{newTip}, attach...)
+			newTip = bc.parentOf(newTip)
+		}
+	}
+
+	return detach, attach
+}
+
+func (bc *Blockchain) parentOf(block *Block) *Block {
+	parent, err := bc.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return &parent
+}
+
+// 将区块连接到主链末端：在同一个存储事务中更新tip、各个索引和UTXO集，并把已打包的交易移出交易池
+func (bc *Blockchain) connectBlock(block *Block) {
+	UTXOSet := UTXOSet{bc}
+
+	err := bc.DB.Update(func(tx StoreTx) error {
+		err := tx.PutTip(block.Hash)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		err = tx.PutHashByHeight(block.Height, block.Hash)
 		if err != nil {
 			log.Panic(err)
 		}
 
-		lastHash := b.Get([]byte("l"))
-		lastBlockData := b.Get(lastHash)
-		lastBlock := DeserializeBlock(lastBlockData)
+		if tx.IsTxIndexEnabled() {
+			indexTransactions(tx, block)
+		}
+		err = indexAddresses(tx, block)
+		if err != nil {
+			return err
+		}
+		err = indexData(tx, block)
+		if err != nil {
+			return err
+		}
+		return UTXOSet.update(tx, block)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	bc.Tip = block.Hash
+
+	removeFromMempool(block.Transactions)
+}
+
+// 将主链末端的区块断开，区块中的普通交易重新放回交易池
+func (bc *Blockchain) disconnectBlock(block *Block) {
+	bc.detachBlock(block)
+
+	addToMempool(block.Transactions)
+}
+
+// 回滚主链末端的区块：tip回退到父区块，删除它在索引中的记录，根据撤销数据恢复UTXO集
+func (bc *Blockchain) detachBlock(block *Block) {
+	UTXOSet := UTXOSet{bc}
+
+	err := bc.DB.Update(func(tx StoreTx) error {
+		err := tx.PutTip(block.PrevBlockHash)
+		if err != nil {
+			log.Panic(err)
+		}
 
-		if block.Height > lastBlock.Height {
-			err = b.Put([]byte("l"), block.Hash)
+		err = tx.DeleteHashByHeight(block.Height)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if tx.IsTxIndexEnabled() {
+			unindexTransactions(tx, block)
+		}
+		err = unindexAddresses(tx, block)
+		if err != nil {
+			return err
+		}
+		err = unindexData(tx, block)
+		if err != nil {
+			return err
+		}
+		UTXOSet.rollback(tx, block)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+	bc.Tip = block.PrevBlockHash
+}
+
+// 记住验证失败的区块，再次收到这个区块或者它的后代时直接拒绝
+func (bc *Blockchain) markInvalid(block *Block) {
+	if bc.invalid == nil {
+		bc.invalid = make(map[string]bool)
+	}
+	bc.invalid[string(block.Hash)] = true
+}
+
+// 删除验证失败的区块，使它们不会再被选为主链
+func (bc *Blockchain) removeBlocks(blocks []*Block) {
+	err := bc.DB.Update(func(tx StoreTx) error {
+		for _, block := range blocks {
+			err := tx.DeleteBlock(block.Hash)
+			if err != nil {
+				log.Panic(err)
+			}
+
+			err = tx.DeleteChainWork(block.Hash)
 			if err != nil {
 				log.Panic(err)
 			}
-			bc.Tip = block.Hash
 		}
 
 		return nil
@@ -73,15 +297,34 @@ func NewBlockchain(nodeID string) *Blockchain {
 		os.Exit(1)
 	}
 
+	store, err := OpenBoltStore(dbFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// 旧版本节点创建的数据库编码不同，直接读取会出错
+	err = checkStoreFormat(store)
+	if err != nil {
+		store.Close()
+		fmt.Printf("%s: %s\n", dbFile, err)
+		fmt.Println("Remove it and run createblockchain or sync from other nodes again.")
+		os.Exit(1)
+	}
+
+	return NewBlockchainWithStore(store)
+}
+
+// 使用给定的存储后端中已有的区块链
+func NewBlockchainWithStore(store Store) *Blockchain {
 	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
+
+	err := checkStoreFormat(store)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("l"))
+	err = store.View(func(tx StoreTx) error {
+		tip = tx.GetTip()
 
 		return nil
 	})
@@ -90,7 +333,7 @@ func NewBlockchain(nodeID string) *Blockchain {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{tip, store, AdjustedTime, nil}
 
 	return &bc
 }
@@ -103,110 +346,122 @@ func CreateBlockchain(address string, nodeID string) *Blockchain {
 		os.Exit(1)
 	}
 
-	var tip []byte
-
-	cbtx := transaction.NewCoinbaseTX(address, genesisCoinbaseData)
-	genesis := NewGenesisBlock(cbtx)
-
-	db, err := bolt.Open(dbFile, 0600, nil)
+	store, err := OpenBoltStore(dbFile)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	return CreateBlockchainWithStore(address, store)
+}
+
+// 在给定的存储后端中创建区块链，创世区块的奖励发给address
+func CreateBlockchainWithStore(address string, store Store) *Blockchain {
+	bc := Blockchain{nil, store, AdjustedTime, nil}
 
-		b, err := tx.CreateBucket([]byte(blocksBucket))
+	cbtx := transaction.NewCoinbaseTX(address, genesisCoinbaseData, 0, 0)
+	genesis := NewGenesisBlock(cbtx, bc.Clock.Now())
+
+	err := store.Update(func(tx StoreTx) error {
+		err := tx.PutFormatVersion(storeFormatVersion)
 		if err != nil {
 			log.Panic(err)
 		}
 
-		err = b.Put(genesis.Hash, genesis.Serialize())
+		err = tx.PutBlock(genesis)
 		if err != nil {
 			log.Panic(err)
 		}
 
-		err = b.Put([]byte("l"), genesis.Hash)
+		err = tx.PutTip(genesis.Hash)
 		if err != nil {
 			log.Panic(err)
 		}
-		tip = genesis.Hash
+		bc.Tip = genesis.Hash
 
-		return nil
+		err = tx.PutHashByHeight(genesis.Height, genesis.Hash)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		err = tx.PutChainWork(genesis.Hash, NewProofOfWork(genesis).Work())
+		if err != nil {
+			log.Panic(err)
+		}
+
+		err = indexAddresses(tx, genesis)
+		if err != nil {
+			return err
+		}
+		err = indexData(tx, genesis)
+		if err != nil {
+			return err
+		}
+
+		UTXOSet := UTXOSet{&bc}
+		return UTXOSet.update(tx, genesis)
 	})
 
 	if err != nil {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
-
 	return &bc
 }
 
-// 查看余额：找到未包含在任何交易输入中的输出
-func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []transaction.Transaction {
-	var unspentTXs []transaction.Transaction
-	// spentTXOs：交易ID->该笔交易中哪些输出已经被包含在其它交易的输入中了
-	spentTXOs := make(map[string][]int)
-	bci := bc.Iterator()
-	// 遍历区块链中的每一个区块
-	for {
-		block := bci.Next()
+// 普通交易：from给to发amount个币，另外支付fee个币的手续费给打包交易的矿工。
+// lockTime不为0时，交易在这个区块高度或时间之后才能打包；data不为nil时，交易还包含一个携带data的数据输出
+func NewUTXOTransaction(wallet_from *wallet.Wallet, to string, amount, fee int, lockTime uint32, data []byte, utxoset *UTXOSet) *transaction.Transaction {
+	pubKeyHash := wallet.HashPubKey(wallet_from.PublicKey)
+	from := fmt.Sprintf("%s", wallet_from.GetAddress())
 
-		// 遍历一个区块中的所有交易
-	    for _, tx := range block.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-			// 对于每一笔交易，遍历所有的输出
-			Outputs:
-			for outIdx, out := range tx.Vout {
-				// 查看spentTXOs中是否包括当前交易ID，是，则继续遍历，否则，即找到一个未包含在任何交易输入中的输出
-				if spentTXOs[txID] != nil {
-					for _, spentOut := range spentTXOs[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
-					}
-				}
-				// 我们不需要关注不能被解锁的交易
-				if out.IsLockedWithKey(pubKeyHash) {
-					// 此时将该笔交易加入结果集中
-					unspentTXs = append(unspentTXs, *tx)
-				}
-			}
+	tx := newUnsignedTransaction(pubKeyHash, from, to, amount, fee, lockTime, data, utxoset)
+	utxoset.Blockchain.SignTransaction(tx, wallet_from.PrivateKey)
 
-			// 如果当前交易不是coinbase交易（有1个或多个交易输入），则遍历当前交易的所有输入
-			if tx.IsCoinbase() == false {
-				for _, in := range tx.Vin {
-					// 我们不需要关注不能被解锁的交易
-					if in.UsesKey(pubKeyHash) {
-						// 上一笔交易的输出，就是这笔交易的输入，此时将上一笔交易ID和对应的输出索引，记录在spentTXOs中
-						inTxID := hex.EncodeToString(in.Txid)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-					}
-				}
-			}
-	  	}
+	return tx
+}
 
-		// PrevBlockHash长度为0，代表已经遍历到初始块，此时遍历结束，退出循环
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+// 从多重签名地址给to发amount个币的交易，还没有签名。
+// 各个签名者依次用Transaction.SignMultiSig添加签名，签名个数达到要求后交易才有效
+func NewMultiSigTransaction(redeemScript script.Script, to string, amount, fee int, lockTime uint32, utxoset *UTXOSet) *transaction.Transaction {
+	scriptHash := util.Hash160(redeemScript)
+	from := fmt.Sprintf("%s", wallet.ScriptHashAddress(redeemScript))
+
+	return newUnsignedTransaction(scriptHash, from, to, amount, fee, lockTime, nil, utxoset)
+}
+
+// 从HTLC地址给to发amount个币的交易，还没有签名，由收款人或退款人用Transaction.SignHTLC签名。
+// refund为true时是超时后的退款交易，锁定时间设为合约的超时时间
+func NewHTLCTransaction(redeemScript script.Script, to string, amount, fee int, refund bool, utxoset *UTXOSet) *transaction.Transaction {
+	h, ok := script.ExtractHTLC(redeemScript)
+	if !ok {
+		log.Panic("ERROR: Redeem script is not an HTLC script")
 	}
-  
-	return unspentTXs
+	lockTime := uint32(0)
+	if refund {
+		lockTime = h.LockTime
+	}
+
+	scriptHash := util.Hash160(redeemScript)
+	from := fmt.Sprintf("%s", wallet.ScriptHashAddress(redeemScript))
+
+	return newUnsignedTransaction(scriptHash, from, to, amount, fee, lockTime, nil, utxoset)
 }
 
-// 普通交易：from给to发amount个币
-func NewUTXOTransaction(wallet_from *wallet.Wallet, to string, amount int, utxoset *UTXOSet) *transaction.Transaction {
+// 花费地址from（地址中的哈希为addressHash）的输出，构造给to发amount个币、支付fee个币手续费的交易，找零发回from。
+// data不为nil时加入携带data的数据输出
+func newUnsignedTransaction(addressHash []byte, from, to string, amount, fee int, lockTime uint32, data []byte, utxoset *UTXOSet) *transaction.Transaction {
 	var inputs []transaction.TXInput
 	var outputs []transaction.TXOutput
 
-	
-	pubKeyHash := wallet.HashPubKey(wallet_from.PublicKey)
+	// 序列号为MaxSequence时锁定时间不起作用，设置了锁定时间的交易使用MaxSequence-1，同时不启用相对锁定时间
+	sequence := uint32(transaction.MaxSequence)
+	if lockTime != 0 {
+		sequence--
+	}
 
-	// 找到所有未花费的输出，并计算它们的value和是否足够
-	acc, validOutputs := utxoset.FindSpendableOutputs(pubKeyHash, amount)
-	if acc < amount {
+	// 找到所有未花费的输出，并计算它们的value和是否足够支付amount和手续费
+	acc, validOutputs := utxoset.FindSpendableOutputs(addressHash, amount+fee)
+	if acc < amount+fee {
 		log.Panic("ERROR: Not enough funds")
 	}
 
@@ -218,95 +473,71 @@ func NewUTXOTransaction(wallet_from *wallet.Wallet, to string, amount int, utxos
 		}
 		//  一个交易ID对应多个交易输出，所以还要遍历一次
 		for _, out := range outs {
-			// 构造交易输入
-			input := transaction.TXInput{txID, out, nil, wallet_from.PublicKey}
+			// 构造交易输入，解锁脚本在签名时填入
+			input := transaction.TXInput{Txid: txID, Vout: out, Sequence: sequence}
 			inputs = append(inputs, input)
 		}
 	}
 
-	from := fmt.Sprintf("%s", wallet_from.GetAddress())
 	// 构造一个交易输出
 	outputs = append(outputs, *transaction.NewTXOutput(amount, to))
-	// 如果未花费的币的数量超过了新交易的输入数量，多余的币还要退还给from，因此还要构造一个交易输出，输出地址是from
-	if acc > amount {
-		outputs = append(outputs, *transaction.NewTXOutput(acc - amount, from)) // a change
+	if data != nil {
+		outputs = append(outputs, *transaction.NewDataTXOutput(data))
+	}
+	// 如果未花费的币的数量超过了新交易的输入数量，多余的币还要退还给from，因此还要构造一个交易输出，输出地址是from。
+	// 输入与输出的差额就是手续费
+	if acc > amount+fee {
+		outputs = append(outputs, *transaction.NewTXOutput(acc - amount - fee, from)) // a change
 	}
 
-	tx := transaction.Transaction{nil, inputs, outputs}
+	tx := transaction.Transaction{Vin: inputs, Vout: outputs, LockTime: lockTime}
 	tx.ID = tx.Hash()
-	utxoset.Blockchain.SignTransaction(&tx, wallet_from.PrivateKey)
 
 	return &tx
 }
-// 找到所有未花费的输出，并计算它们的value和是否足够
-func (bc *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	// 记录所有未花费交易输出
-	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-
-	Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
-
-		for outIdx, out := range tx.Vout {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
-	}
-
-	return accumulated, unspentOutputs
-}
-
 // 所有交易打包为一个区块，写入数据库中
 func (bc *Blockchain) MineBlock(transactions []*transaction.Transaction) *Block {
-	var lastHash []byte
-	var lastHeight int
-
 	for _, tx := range transactions {
 		if bc.VerifyTransaction(tx) != true {
 			log.Panic("ERROR: Invalid transaction")
 		}
 	}
 
-	err := bc.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
-
-		blockData := b.Get(lastHash)
-		block := DeserializeBlock(blockData)
-
-		lastHeight = block.Height
+	newBlock, err := bc.MineBlockContext(context.Background(), DefaultMiner, transactions)
+	if err != nil {
+		log.Panic(err)
+	}
 
-		return nil
-	})
+	return newBlock
+}
 
+// 根据ID获取交易。开启了交易索引时直接查索引，否则从tip开始遍历主链
+func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error) {
+	block, index, err := bc.findTransactionLocation(ID)
 	if err != nil {
-		log.Panic(err)
+		return transaction.Transaction{}, err
 	}
 
-	
-	newBlock := NewBlock(transactions, lastHash, lastHeight+1)
+	return *block.Transactions[index], nil
+}
 
-	err = bc.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		err := b.Put(newBlock.Hash, newBlock.Serialize())
-		if err != nil {
-			log.Panic(err)
-		}
+// 找到主链上包含交易的区块，以及交易在区块中的序号。开启交易索引时只查索引
+func (bc *Blockchain) findTransactionLocation(ID []byte) (*Block, int, error) {
+	var found *Block
+	var index int
+	indexed := false
 
-		err = b.Put([]byte("l"), newBlock.Hash)
-		if err != nil {
-			log.Panic(err)
+	err := bc.DB.View(func(tx StoreTx) error {
+		if !tx.IsTxIndexEnabled() {
+			return nil
 		}
+		indexed = true
 
-		bc.Tip = newBlock.Hash
+		loc := tx.GetTxLocation(ID)
+		if loc != nil {
+			found = tx.GetBlock(loc.BlockHash)
+			index = loc.Index
+		}
 
 		return nil
 	})
@@ -314,63 +545,21 @@ func (bc *Blockchain) MineBlock(transactions []*transaction.Transaction) *Block
 		log.Panic(err)
 	}
 
-	return newBlock
-}
-
-// 查余额：找到所有未花费的输出，计算所有输出的value和
-func (bc *Blockchain) FindUTXO() map[string]transaction.TXOutputs {
-	UTXO := make(map[string]transaction.TXOutputs)
-	spentTXOs := make(map[string][]int)
-	bci := bc.Iterator()
-
-	for {
-		block := bci.Next()
-
-		for _, tx := range block.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-
-		Outputs:
-			for outIdx, out := range tx.Vout {
-				// Was the output spent?
-				if spentTXOs[txID] != nil {
-					for _, spentOutIdx := range spentTXOs[txID] {
-						if spentOutIdx == outIdx {
-							continue Outputs
-						}
-					}
-				}
-
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				UTXO[txID] = outs
-			}
-
-			if tx.IsCoinbase() == false {
-				for _, in := range tx.Vin {
-					inTxID := hex.EncodeToString(in.Txid)
-					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-				}
-			}
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+	if found != nil {
+		return found, index, nil
+	}
+	if indexed {
+		return nil, 0, errors.New("Transaction is not found")
 	}
 
-	return UTXO
-}
-
-// 根据ID获取交易
-func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error) {
 	bci := bc.Iterator()
 
 	for {
 		block := bci.Next()
 
-		for _, tx := range block.Transactions {
+		for i, tx := range block.Transactions {
 			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
+				return block, i, nil
 			}
 		}
 
@@ -379,7 +568,7 @@ func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error
 		}
 	}
 
-	return transaction.Transaction{}, errors.New("Transaction is not found")
+	return nil, 0, errors.New("Transaction is not found")
 }
 
 // 对交易输入引用的之前的交易进行签名
@@ -419,11 +608,8 @@ func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) bool {
 func (bc *Blockchain) GetBestHeight() int {
 	var lastBlock Block
 
-	err := bc.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("l"))
-		blockData := b.Get(lastHash)
-		lastBlock = *DeserializeBlock(blockData)
+	err := bc.DB.View(func(tx StoreTx) error {
+		lastBlock = *tx.GetBlock(tx.GetTip())
 
 		return nil
 	})
@@ -438,16 +624,14 @@ func (bc *Blockchain) GetBestHeight() int {
 func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	var block Block
 
-	err := bc.DB.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-
-		blockData := b.Get(blockHash)
+	err := bc.DB.View(func(tx StoreTx) error {
+		blockInDb := tx.GetBlock(blockHash)
 
-		if blockData == nil {
+		if blockInDb == nil {
 			return errors.New("Block is not found.")
 		}
 
-		block = *DeserializeBlock(blockData)
+		block = *blockInDb
 
 		return nil
 	})
@@ -474,4 +658,104 @@ func (bc *Blockchain) GetBlockHashes() [][]byte {
 	}
 
 	return blocks
-}
\ No newline at end of file
+}
+
+// 根据高度获取主链上的区块
+func (bc *Blockchain) GetBlockByHeight(height int) (Block, error) {
+	var block Block
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		hash := tx.GetHashByHeight(height)
+		if hash == nil {
+			return errors.New("Block is not found.")
+		}
+
+		block = *tx.GetBlock(hash)
+
+		return nil
+	})
+	if err != nil {
+		return block, err
+	}
+
+	return block, nil
+}
+
+// 返回主链上高度从from到to（包含两端）的区块哈希，按高度从低到高排列。超出主链高度的部分被忽略
+func (bc *Blockchain) GetBlockHashesRange(from, to int) [][]byte {
+	var hashes [][]byte
+
+	if from < 0 {
+		from = 0
+	}
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		for height := from; height <= to; height++ {
+			hash := tx.GetHashByHeight(height)
+			if hash == nil {
+				break
+			}
+			hashes = append(hashes, hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return hashes
+}
+
+// 返回区块定位器：从tip开始，先逐个、再以成倍增加的间隔选取主链上的区块哈希，最后是创世区块。
+// 对方据此可以找到双方主链的分叉点，只发送分叉点之后的区块
+func (bc *Blockchain) GetBlockLocator() [][]byte {
+	var locator [][]byte
+	height := bc.GetBestHeight()
+	step := 1
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		for height > 0 {
+			locator = append(locator, tx.GetHashByHeight(height))
+
+			if len(locator) >= 10 {
+				step *= 2
+			}
+			height -= step
+		}
+		locator = append(locator, tx.GetHashByHeight(0))
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return locator
+}
+
+// 找到定位器中第一个位于主链上的区块，返回它的高度；都不在主链上时返回-1
+func (bc *Blockchain) findLocatorFork(locator [][]byte) int {
+	fork := -1
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		for _, hash := range locator {
+			block := tx.GetBlock(hash)
+			if block == nil {
+				continue
+			}
+
+			if bytes.Compare(tx.GetHashByHeight(block.Height), hash) == 0 {
+				fork = block.Height
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return fork
+}
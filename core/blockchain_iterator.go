@@ -2,14 +2,12 @@ package core
 
 import (
 	"log"
-
-	"github.com/boltdb/bolt"
 )
 
 // BlockchainIterator is used to iterate over blockchain blocks
 type BlockchainIterator struct {
 	currentHash []byte
-	db          *bolt.DB
+	db          Store
 }
 
 func (bc *Blockchain) Iterator() *BlockchainIterator {
@@ -22,10 +20,8 @@ func (bc *Blockchain) Iterator() *BlockchainIterator {
 func (i *BlockchainIterator) Next() *Block {
 	var block *Block
 
-	err := i.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		encodedBlock := b.Get(i.currentHash)
-		block = DeserializeBlock(encodedBlock)
+	err := i.db.View(func(tx StoreTx) error {
+		block = tx.GetBlock(i.currentHash)
 
 		return nil
 	})
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+)
+
+// 挖矿控制命令使用的Unix socket。只有本机上有权限访问这个文件的用户才能连接
+const controlNetwork = "unix"
+
+// 节点nodeID的控制socket的路径，与数据库文件放在同一个目录
+func controlAddress(nodeID string) string {
+	return fmt.Sprintf("node_%s.sock", nodeID)
+}
+
+// 监听节点的控制socket。上次运行异常退出时留下的socket文件会被删除
+func listenControl(nodeID string) (net.Listener, error) {
+	addr := controlAddress(nodeID)
+
+	err := os.Remove(addr)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	ln, err := net.Listen(controlNetwork, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(addr, 0600)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// 处理控制socket上的连接，直到监听被关闭
+func serveControl(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go handleControlConnection(conn)
+	}
+}
+
+// 处理本机命令行发来的挖矿控制命令，在同一个连接上回复挖矿服务的状态。节点没有开启挖矿时回复空的状态。
+// 控制命令不访问区块链，不能持有chainLock：停止挖矿要等待挖矿协程退出，而它可能正在等待chainLock
+func handleControlConnection(conn net.Conn) {
+	defer conn.Close()
+
+	request, err := ioutil.ReadAll(conn)
+	if err != nil || len(request) < commandLength {
+		fmt.Printf("Malformed control request: %v\n", err)
+		return
+	}
+	command := bytesToCommand(request[:commandLength])
+
+	var status MiningStatus
+	if miningService != nil {
+		switch command {
+		case "startmining":
+			miningService.Start()
+		case "stopmining":
+			miningService.Stop()
+		case "miningstatus":
+		default:
+			fmt.Printf("Unknown control command %s\n", command)
+			return
+		}
+		status = miningService.Status()
+	}
+
+	_, err = conn.Write(gobEncode(status))
+	if err != nil {
+		fmt.Printf("Failed to reply to %s: %s\n", command, err)
+	}
+}
+
+// RequestMiningStatus asks the local node nodeID for the state of its mining service
+func RequestMiningStatus(nodeID string) (MiningStatus, error) {
+	return requestMiningControl(controlAddress(nodeID), "miningstatus")
+}
+
+// RequestStartMining asks the local node nodeID to start mining and returns the state after it started
+func RequestStartMining(nodeID string) (MiningStatus, error) {
+	return requestMiningControl(controlAddress(nodeID), "startmining")
+}
+
+// RequestStopMining asks the local node nodeID to stop mining and returns the state after it stopped
+func RequestStopMining(nodeID string) (MiningStatus, error) {
+	return requestMiningControl(controlAddress(nodeID), "stopmining")
+}
+
+func requestMiningControl(addr, command string) (MiningStatus, error) {
+	var status MiningStatus
+
+	conn, err := net.Dial(controlNetwork, addr)
+	if err != nil {
+		return status, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(commandToBytes(command))
+	if err != nil {
+		return status, err
+	}
+	// 节点读到EOF后才处理命令
+	err = conn.(*net.UnixConn).CloseWrite()
+	if err != nil {
+		return status, err
+	}
+
+	err = gob.NewDecoder(conn).Decode(&status)
+
+	return status, err
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"log"
+	"math/big"
+)
+
+// 每隔retargetInterval个区块调整一次难度
+const retargetInterval = 10
+
+// 期望的出块间隔（秒）
+const targetSpacing = 10
+
+// 难度允许的最大目标值，即最低难度：区块哈希值前面至少有TargetBits个0
+func powLimit() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-TargetBits))
+}
+
+// 创世区块使用最低难度
+func genesisBits() uint32 {
+	return BigToCompact(powLimit())
+}
+
+// 根据父区块计算下一个区块应当使用的难度。
+// 每retargetInterval个区块，根据上一个周期实际花费的时间调整目标值，单次调整幅度限制在4倍以内
+func (bc *Blockchain) nextBits(parent *Block) uint32 {
+	height := parent.Height + 1
+	if height%retargetInterval != 0 {
+		return parent.Bits
+	}
+
+	// 从上一个周期的最后一个区块量到父区块，正好包含retargetInterval个出块间隔。
+	// 第一次调整时前面只有创世区块，间隔少一个，期望时长按实际的间隔数计算
+	intervals := int64(retargetInterval)
+	if parent.Height < retargetInterval {
+		intervals = int64(parent.Height)
+	}
+	first := parent
+	for i := int64(0); i < intervals; i++ {
+		block, err := bc.GetBlock(first.PrevBlockHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		first = &block
+	}
+
+	expectedTimespan := intervals * targetSpacing
+	actualTimespan := parent.Timestamp - first.Timestamp
+	if actualTimespan < expectedTimespan/4 {
+		actualTimespan = expectedTimespan / 4
+	}
+	if actualTimespan > expectedTimespan*4 {
+		actualTimespan = expectedTimespan * 4
+	}
+
+	// 新目标值 = 旧目标值 * 实际时长 / 期望时长
+	target := CompactToBig(parent.Bits)
+	target.Mul(target, big.NewInt(actualTimespan))
+	target.Div(target, big.NewInt(expectedTimespan))
+
+	if limit := powLimit(); target.Cmp(limit) > 0 {
+		target.Set(limit)
+	}
+
+	return BigToCompact(target)
+}
+
+// 将压缩格式的难度转换为目标值。
+// 压缩格式与比特币的nBits相同：最高字节是指数（字节数），低三个字节是尾数
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := int64(compact & 0x007fffff)
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(mantissa)
+	} else {
+		target = big.NewInt(mantissa)
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	return target
+}
+
+// 将目标值转换为压缩格式的难度
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64())
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		shifted := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = uint32(shifted.Uint64())
+	}
+
+	// 尾数的最高位是符号位，被占用时将尾数右移一个字节
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	return uint32(exponent<<24) | mantissa
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"blockchain/util"
+	"math/big"
+	"testing"
+)
+
+// 构造一条每个区块间隔spacing秒、难度都是bits的链（不需要挖矿），返回链和最后一个区块
+func retargetChain(t *testing.T, bits uint32, length int, spacing int64) (*Blockchain, *Block) {
+	t.Helper()
+
+	bc := &Blockchain{nil, NewMemoryStore(), AdjustedTime, nil}
+	var parent *Block
+	for height := 0; height < length; height++ {
+		block := &Block{Height: height}
+		block.Version = BlockVersion
+		block.Bits = bits
+		block.Timestamp = 1600000000 + int64(height)*spacing
+		if parent != nil {
+			block.PrevBlockHash = parent.Hash
+		}
+		block.Hash = util.IntToHex(int64(height))
+		err := bc.DB.Update(func(tx StoreTx) error {
+			return tx.PutBlock(block)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parent = block
+	}
+
+	return bc, parent
+}
+
+func TestNextBitsRetarget(t *testing.T) {
+	// 远低于最低难度，放大4倍也不会被powLimit截断
+	target := new(big.Int).Rsh(powLimit(), 16)
+	bits := BigToCompact(target)
+	target = CompactToBig(bits)
+	scaled := func(num, den int64) uint32 {
+		scaledTarget := new(big.Int).Mul(target, big.NewInt(num))
+		return BigToCompact(scaledTarget.Div(scaledTarget, big.NewInt(den)))
+	}
+
+	tests := []struct {
+		name    string
+		length  int
+		spacing int64
+		want    uint32
+	}{
+		{"not a retarget height", 15, 1, bits},
+		{"on schedule", 20, targetSpacing, bits},
+		{"first retarget on schedule", 10, targetSpacing, bits},
+		{"fast window", 20, targetSpacing / 2, scaled(1, 2)},
+		{"slow window", 20, targetSpacing * 2, scaled(2, 1)},
+		{"fast window clamped to 4x", 20, 1, scaled(1, 4)},
+		{"slow window clamped to 4x", 20, targetSpacing * 10, scaled(4, 1)},
+	}
+	for _, test := range tests {
+		bc, parent := retargetChain(t, bits, test.length, test.spacing)
+		if got := bc.nextBits(parent); got != test.want {
+			t.Errorf("%s: nextBits() = %08x, want %08x", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNextBitsIsCappedAtPowLimit(t *testing.T) {
+	bc, parent := retargetChain(t, genesisBits(), 20, targetSpacing*2)
+	if got := bc.nextBits(parent); got != genesisBits() {
+		t.Fatalf("nextBits() = %08x, want the minimum difficulty %08x", got, genesisBits())
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"fmt"
+	"log"
+)
+
+// 检查交易的锁定时间和每个输入的相对锁定时间是否允许它打包进高度为height的区块。
+// medianTime是父区块的过去中位时间，inputHeights是每个输入引用的输出所在区块的高度
+func (bc *Blockchain) checkTxLocks(tx *transaction.Transaction, height int, medianTime int64, inputHeights []int) error {
+	if !tx.IsFinal(height, medianTime) {
+		return fmt.Errorf("%w: transaction %x is locked until %d", ErrNonFinalTx, tx.ID, tx.LockTime)
+	}
+
+	for i, vin := range tx.Vin {
+		sequence := vin.Sequence
+		if sequence&transaction.SequenceLockTimeDisableFlag != 0 {
+			continue
+		}
+		value := int64(sequence & transaction.SequenceLockTimeMask)
+
+		if sequence&transaction.SequenceLockTimeTypeFlag == 0 {
+			if int64(height-inputHeights[i]) < value {
+				return fmt.Errorf("%w: input %d of transaction %x needs %d confirmations", ErrSequenceLocked, i, tx.ID, value)
+			}
+			continue
+		}
+
+		// 按时间计算时，从引用的输出所在区块的父区块的过去中位时间开始
+		prevHeight := inputHeights[i] - 1
+		if prevHeight < 0 {
+			prevHeight = 0
+		}
+		prevBlock, err := bc.GetBlockByHeight(prevHeight)
+		if err != nil {
+			log.Panic(err)
+		}
+		elapsed := medianTime - bc.medianTimePast(&prevBlock)
+		if elapsed < value<<transaction.SequenceLockTimeGranularity {
+			return fmt.Errorf("%w: input %d of transaction %x needs %d seconds", ErrSequenceLocked, i, tx.ID, value<<transaction.SequenceLockTimeGranularity)
+		}
+	}
+
+	return nil
+}
+
+// 检查交易的锁定时间和相对锁定时间是否允许它打包进下一个区块，交易池接受交易时使用。
+// 引用的输出不在UTXO集中（还在交易池中）时，按在下一个区块中确认计算
+func (bc *Blockchain) CheckTransactionLocks(tx *transaction.Transaction) error {
+	tip, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return bc.checkNextBlockLocks(tx, tip.Height+1, bc.medianTimePast(&tip))
+}
+
+func (bc *Blockchain) checkNextBlockLocks(tx *transaction.Transaction, height int, medianTime int64) error {
+	UTXOSet := UTXOSet{bc}
+	inputHeights := make([]int, len(tx.Vin))
+
+	for i, vin := range tx.Vin {
+		inputHeights[i] = height
+		if entry := UTXOSet.GetEntry(vin.Txid, vin.Vout); entry != nil {
+			inputHeights[i] = entry.Height
+		}
+	}
+
+	return bc.checkTxLocks(tx, height, medianTime, inputHeights)
+}
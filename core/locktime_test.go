@@ -0,0 +1,91 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// 区块间隔1000秒的链：高度0、1、2，下一个区块的高度是3，主链末端的过去中位时间比创世区块晚1000秒。
+// 返回链、收款地址和构造花费创世区块奖励的交易的函数，锁定时间和序列号在签名之前设置
+func newLockTestChain(t *testing.T) (*Blockchain, string, func(lockTime, sequence uint32) *transaction.Transaction) {
+	t.Helper()
+
+	bc, w, address := newTestChain(t)
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{genesis.Timestamp}
+	bc.Clock = clock
+	for i := 0; i < 2; i++ {
+		clock.now += 1000
+		if _, err := addBlockAt(t, bc, address, clock.now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.now += 1000
+
+	coinbase := genesis.Transactions[0]
+	spend := func(lockTime, sequence uint32) *transaction.Transaction {
+		tx := &transaction.Transaction{
+			Vin:      []transaction.TXInput{{Txid: coinbase.ID, Vout: 0, Sequence: sequence}},
+			Vout:     []transaction.TXOutput{*transaction.NewTXOutput(coinbase.Vout[0].Value-1, address)},
+			LockTime: lockTime,
+		}
+		tx.ID = tx.Hash()
+		tx.Sign(w.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(coinbase.ID): *coinbase})
+
+		return tx
+	}
+
+	return bc, address, spend
+}
+
+func TestLockTimeAndSequenceLocks(t *testing.T) {
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+
+	height := func(h uint32) func(int64) uint32 {
+		return func(int64) uint32 { return h }
+	}
+	// 相对于主链末端的过去中位时间的锁定时间
+	timeOffset := func(offset int64) func(int64) uint32 {
+		return func(medianTime int64) uint32 { return uint32(medianTime + offset) }
+	}
+
+	tests := []struct {
+		name     string
+		lockTime func(medianTime int64) uint32
+		sequence uint32
+		want     error
+	}{
+		{"height lock reached", height(2), transaction.MaxSequence - 1, nil},
+		{"height lock not reached", height(3), transaction.MaxSequence - 1, ErrNonFinalTx},
+		{"lock time disabled by final sequences", height(100), transaction.MaxSequence, nil},
+		{"time lock reached", timeOffset(-1), transaction.MaxSequence - 1, nil},
+		{"time lock not reached", timeOffset(0), transaction.MaxSequence - 1, ErrNonFinalTx},
+		{"relative height lock reached", height(0), transaction.SequenceFromBlocks(3), nil},
+		{"relative height lock not reached", height(0), transaction.SequenceFromBlocks(4), ErrSequenceLocked},
+		{"relative time lock reached", height(0), transaction.SequenceFromSeconds(512), nil},
+		{"relative time lock not reached", height(0), transaction.SequenceFromSeconds(1024), ErrSequenceLocked},
+		{"relative lock disabled", height(0), transaction.SequenceLockTimeDisableFlag | transaction.SequenceFromBlocks(100), nil},
+	}
+	for _, test := range tests {
+		bc, address, spend := newLockTestChain(t)
+		tip, err := bc.GetBlock(bc.Tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx := spend(test.lockTime(bc.medianTimePast(&tip)), test.sequence)
+
+		// 交易池按下一个区块检查，与打包进区块时的结果相同
+		if _, err := bc.CheckMempoolTransaction(tx); !errors.Is(err, test.want) {
+			t.Errorf("%s: CheckMempoolTransaction() = %v, want %v", test.name, err, test.want)
+		}
+		if err := bc.AddBlock(mineOn(t, bc, &tip, address, tx)); !errors.Is(err, test.want) {
+			t.Errorf("%s: AddBlock() = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -1,11 +1,23 @@
 package core
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
+	"log"
 )
 
 type MerkleTree struct {
     RootNode *MerkleNode
+    // 每一层节点的哈希，第0层是叶子，最后一层是根
+    levels [][][]byte
+}
+
+// MerkleProof 是叶子到根的路径上每一层的兄弟节点哈希，从叶子所在的层开始。
+// Index是叶子的序号，它的每一位决定了对应层的兄弟节点在左边还是右边
+type MerkleProof struct {
+	Index    int
+	Siblings [][]byte
 }
 
 type MerkleNode struct {
@@ -14,42 +26,59 @@ type MerkleNode struct {
     Data  []byte
 }
 
+// 计算叶子节点和内部节点哈希时加上不同的前缀，内部节点的哈希不能冒充叶子
+const (
+	merkleLeafPrefix  = 0x00
+	merkleInnerPrefix = 0x01
+)
+
+// 由叶子数据构建Merkle树。每一层节点个数为奇数时复制最后一个节点与自己配对，直到只剩根节点
 func NewMerkleTree(data [][]byte) *MerkleTree {
 	var nodes []MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		log.Panic("ERROR: Merkle tree needs at least one leaf")
 	}
 
 	for _, datum := range data {
 		node := NewMerkleNode(nil, nil, datum)
 		nodes = append(nodes, *node)
 	}
+	// 记录的是复制之前的节点，复制出来的节点不能生成证明
+	levels := [][][]byte{nodeHashes(nodes)}
 
-	for i := 0; i < len(data)/2; i++ {
+	for len(nodes) > 1 {
 		var newLevel []MerkleNode
 
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
 		for j := 0; j < len(nodes); j += 2 {
 			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
 			newLevel = append(newLevel, *node)
 		}
 
 		nodes = newLevel
+		levels = append(levels, nodeHashes(nodes))
 	}
 
-	mTree := MerkleTree{&nodes[0]}
+	mTree := MerkleTree{&nodes[0], levels}
 
 	return &mTree
 }
 
+// 叶子节点的哈希为 SHA-256(0x00 || data)，内部节点的哈希为 SHA-256(0x01 || left || right)
 func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	mNode := MerkleNode{}
 
 	if left == nil && right == nil {
-		hash := sha256.Sum256(data)
+		leaf := append([]byte{merkleLeafPrefix}, data...)
+		hash := sha256.Sum256(leaf)
 		mNode.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
+		prevHashes := append([]byte{merkleInnerPrefix}, left.Data...)
+		prevHashes = append(prevHashes, right.Data...)
 		hash := sha256.Sum256(prevHashes)
 		mNode.Data = hash[:]
 	}
@@ -58,4 +87,56 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 	mNode.Right = right
 
 	return &mNode
-}
\ No newline at end of file
+}
+
+func nodeHashes(nodes []MerkleNode) [][]byte {
+	var hashes [][]byte
+
+	for _, node := range nodes {
+		hashes = append(hashes, node.Data)
+	}
+
+	return hashes
+}
+
+// Proof returns the sibling path from the index-th leaf up to the root
+func (t *MerkleTree) Proof(index int) (MerkleProof, error) {
+	if index < 0 || index >= len(t.levels[0]) {
+		return MerkleProof{}, errors.New("Leaf index is out of range")
+	}
+
+	proof := MerkleProof{Index: index}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		// 节点个数为奇数时，最后一个节点与自己配对
+		if sibling >= len(level) {
+			sibling = index
+		}
+
+		proof.Siblings = append(proof.Siblings, level[sibling])
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that leaf (the data the leaf node was built from) is included in the tree with the given root
+func VerifyMerkleProof(root, leaf []byte, proof MerkleProof) bool {
+	if proof.Index < 0 {
+		return false
+	}
+
+	hash := NewMerkleNode(nil, nil, leaf).Data
+	index := proof.Index
+
+	for _, sibling := range proof.Siblings {
+		if index%2 == 0 {
+			hash = NewMerkleNode(&MerkleNode{Data: hash}, &MerkleNode{Data: sibling}, nil).Data
+		} else {
+			hash = NewMerkleNode(&MerkleNode{Data: sibling}, &MerkleNode{Data: hash}, nil).Data
+		}
+		index /= 2
+	}
+
+	return index == 0 && bytes.Compare(hash, root) == 0
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func testLeaves(n int) [][]byte {
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("leaf-%d", i)))
+	}
+
+	return leaves
+}
+
+func sha(parts ...[]byte) []byte {
+	hash := sha256.Sum256(bytes.Join(parts, nil))
+
+	return hash[:]
+}
+
+// 按定义逐层计算默克尔根，不使用NewMerkleTree：叶子哈希为sha256(0x00||叶子)，
+// 内部节点为sha256(0x01||左||右)，某一层节点数为奇数时最后一个节点与自己配对
+func referenceMerkleRoot(leaves [][]byte) []byte {
+	var level [][]byte
+	for _, leaf := range leaves {
+		level = append(level, sha([]byte{0x00}, leaf))
+	}
+
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, sha([]byte{0x01}, level[i], level[i+1]))
+		}
+		level = next
+	}
+
+	return level[0]
+}
+
+// 期望的根由另外用Python按同样的定义写的实现计算（hashlib.sha256），并用referenceMerkleRoot再核对一遍
+func TestMerkleRootVectors(t *testing.T) {
+	vectors := []struct {
+		leaves int
+		root   string
+	}{
+		{1, "305df59f9590c3c9ac63d2b2743c388e3792449078cebf7fb3dbe6471643b2b7"},
+		{2, "60a53eed0de87a90c8e59427c59c46253c33a76a09502a51801300927b7e6bdc"},
+		{3, "2e07059fb7dc51ca9951054f3e4bd7174279e77d3fc17bb29acaff97f302974b"},
+		{4, "bdd1c5ff55b19cb6b0e7c761bf9a6ccaa27fbbfc07b74f1fabb6e911a0bd2ab3"},
+		{5, "aaee56ce5e352748dece183c190368682111de3b1b62c410086ee2d21e25b8a6"},
+		{7, "527315d08a63723202beab716389a540888ad51a69741e51a6261b716fc0051c"},
+		{8, "ca6b7b3e674ac86c1027b59c87c064fc3bc27b313294c75f83bd05fdd13f0dcf"},
+		{1000, "16bea58864a8421701097510c038aeabc6794d4c668c193a62fce3047a297af3"},
+	}
+
+	for _, v := range vectors {
+		if reference := hex.EncodeToString(referenceMerkleRoot(testLeaves(v.leaves))); reference != v.root {
+			t.Fatalf("reference root of %d leaves = %s, want %s", v.leaves, reference, v.root)
+		}
+		root := hex.EncodeToString(NewMerkleTree(testLeaves(v.leaves)).RootNode.Data)
+		if root != v.root {
+			t.Errorf("root of %d leaves = %s, want %s", v.leaves, root, v.root)
+		}
+	}
+
+	// 向量之外的叶子个数与按定义计算的结果比较
+	for n := 1; n <= 64; n++ {
+		root := NewMerkleTree(testLeaves(n)).RootNode.Data
+		if want := referenceMerkleRoot(testLeaves(n)); !bytes.Equal(root, want) {
+			t.Errorf("root of %d leaves = %x, want %x", n, root, want)
+		}
+	}
+}
+
+func TestMerkleDomainSeparationAndDuplication(t *testing.T) {
+	leaves := testLeaves(3)
+	l0 := sha([]byte{0x00}, leaves[0])
+	l1 := sha([]byte{0x00}, leaves[1])
+	l2 := sha([]byte{0x00}, leaves[2])
+
+	// 单个叶子的根是加了0x00前缀的叶子哈希，而不是数据本身的哈希
+	if root := NewMerkleTree(leaves[:1]).RootNode.Data; !bytes.Equal(root, l0) || bytes.Equal(root, sha(leaves[0])) {
+		t.Fatalf("single leaf root = %x, want %x", root, l0)
+	}
+
+	// 奇数个节点时最后一个节点与自己配对，内部节点加0x01前缀
+	want := sha([]byte{0x01}, sha([]byte{0x01}, l0, l1), sha([]byte{0x01}, l2, l2))
+	if root := NewMerkleTree(leaves).RootNode.Data; !bytes.Equal(root, want) {
+		t.Fatalf("root of 3 leaves = %x, want %x", root, want)
+	}
+
+	// 内部节点不能冒充叶子：以两个子节点哈希拼接为数据的叶子得到不同的根
+	inner := append(append([]byte{}, l0...), l1...)
+	if bytes.Equal(NewMerkleTree([][]byte{inner}).RootNode.Data, NewMerkleTree(leaves[:2]).RootNode.Data) {
+		t.Fatal("inner node hash collides with a leaf hash")
+	}
+}
+
+func TestMerkleProofsVerify(t *testing.T) {
+	for n := 1; n <= 1000; n++ {
+		leaves := testLeaves(n)
+		tree := NewMerkleTree(leaves)
+		root := tree.RootNode.Data
+
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("n=%d: Proof(%d) error: %v", n, i, err)
+			}
+			if !VerifyMerkleProof(root, leaf, proof) {
+				t.Fatalf("n=%d: proof of leaf %d does not verify", n, i)
+			}
+		}
+
+		if _, err := tree.Proof(n); err == nil {
+			t.Fatalf("n=%d: Proof(%d) succeeded for a missing leaf", n, n)
+		}
+	}
+}
+
+func TestMerkleProofRejectsWrongLeaf(t *testing.T) {
+	leaves := testLeaves(7)
+	tree := NewMerkleTree(leaves)
+
+	proof, err := tree.Proof(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if VerifyMerkleProof(tree.RootNode.Data, leaves[5], proof) {
+		t.Fatal("proof verified a different leaf")
+	}
+
+	proof.Index = 5
+	if VerifyMerkleProof(tree.RootNode.Data, leaves[6], proof) {
+		t.Fatal("proof verified at a different index")
+	}
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Miner 在多个goroutine中并行搜索满足难度目标的nonce，可以通过context随时取消
+type Miner struct {
+	// 并行搜索的goroutine个数，不大于0时使用CPU核数
+	Workers int
+	// 不为nil时，每隔ReportInterval（默认1秒）报告一次每秒计算的哈希次数
+	OnHashrate     func(hashesPerSecond float64)
+	ReportInterval time.Duration
+	// nonce空间用完后更新时间戳时使用的时间，为nil时使用AdjustedTime
+	Clock TimeSource
+}
+
+// NewBlock使用的矿工
+var DefaultMiner = &Miner{}
+
+// 每个goroutine每计算这么多次哈希，累计一次哈希次数并检查是否被取消
+const hashBatch = 1 << 12
+
+// Mine searches for a nonce that makes the block hash meet its target and sets Nonce and Hash.
+// When the whole nonce space is exhausted it rolls the timestamp, or the coinbase extra nonce
+// if the timestamp cannot advance yet, and searches again. Returns ctx.Err() if ctx is cancelled first
+func (m *Miner) Mine(ctx context.Context, block *Block) error {
+	target := CompactToBig(block.Bits)
+	workers := m.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var hashes uint64
+	if m.OnHashrate != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go m.reportHashrate(&hashes, stop)
+	}
+
+	var extraNonce uint64
+	for {
+		nonce, hash, found := searchNonces(ctx, block.Header(), target, workers, &hashes)
+		if found {
+			block.Nonce = nonce
+			block.Hash = hash
+
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		extraNonce++
+		m.rollHeader(block, extraNonce)
+	}
+}
+
+// 把nonce空间平均分给workers个goroutine，找到一个满足条件的nonce或者全部搜索完时返回
+func searchNonces(ctx context.Context, header BlockHeader, target *big.Int, workers int, hashes *uint64) (uint32, []byte, bool) {
+	type result struct {
+		nonce uint32
+		hash  []byte
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, workers)
+	data := header.Serialize()
+	space := uint64(math.MaxUint32) + 1
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		start := space * uint64(i) / uint64(workers)
+		end := space * uint64(i+1) / uint64(workers)
+
+		wg.Add(1)
+		go func(data []byte, start, end uint64) {
+			defer wg.Done()
+
+			var hashInt big.Int
+			var count uint64
+
+			for n := start; n < end; n++ {
+				// nonce是区块头编码的最后4个字节
+				binary.BigEndian.PutUint32(data[len(data)-4:], uint32(n))
+				hash := sha256.Sum256(data)
+
+				hashInt.SetBytes(hash[:])
+				if hashInt.Cmp(target) == -1 {
+					atomic.AddUint64(hashes, count+1)
+					results <- result{uint32(n), hash[:]}
+					cancel()
+					return
+				}
+
+				count++
+				if count == hashBatch {
+					atomic.AddUint64(hashes, count)
+					count = 0
+
+					if ctx.Err() != nil {
+						return
+					}
+				}
+			}
+			atomic.AddUint64(hashes, count)
+		}(append([]byte{}, data...), start, end)
+	}
+
+	wg.Wait()
+
+	select {
+	case r := <-results:
+		return r.nonce, r.hash, true
+	default:
+		return 0, nil, false
+	}
+}
+
+// nonce空间用完后修改区块头：时间已经前进时更新时间戳，否则修改coinbase交易的额外随机数并重新计算Merkle树根
+func (m *Miner) rollHeader(block *Block, extraNonce uint64) {
+	clock := m.Clock
+	if clock == nil {
+		clock = AdjustedTime
+	}
+
+	now := clock.Now()
+	if now > block.Timestamp {
+		block.Timestamp = now
+		return
+	}
+
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		block.Timestamp++
+		return
+	}
+
+	block.Transactions[0].SetExtraNonce(extraNonce)
+	block.MerkleRoot = block.HashTransactions()
+}
+
+func (m *Miner) reportHashrate(hashes *uint64, stop chan struct{}) {
+	interval := m.ReportInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	var lastHashes uint64
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			current := atomic.LoadUint64(hashes)
+			m.OnHashrate(float64(current-lastHashes) / now.Sub(last).Seconds())
+
+			last = now
+			lastHashes = current
+		}
+	}
+}
+
+// 创建一个还没有工作量证明的区块，由Miner.Mine计算Nonce和Hash
+func newUnminedBlock(transactions []*transaction.Transaction, prevBlockHash []byte, height int, bits uint32, timestamp int64) *Block {
+	header := BlockHeader{BlockVersion, prevBlockHash, nil, timestamp, bits, 0}
+	block := &Block{header, transactions, []byte{}, height}
+	block.MerkleRoot = block.HashTransactions()
+
+	return block
+}
+
+// 打包交易并在ctx被取消之前完成工作量证明，然后加入区块链
+func (bc *Blockchain) MineBlockContext(ctx context.Context, miner *Miner, transactions []*transaction.Transaction) (*Block, error) {
+	var lastBlock *Block
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		lastBlock = tx.GetBlock(tx.GetTip())
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	block := newUnminedBlock(transactions, lastBlock.Hash, lastBlock.Height+1, bc.nextBits(lastBlock), bc.nextTimestamp(lastBlock))
+	err = miner.Mine(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.AddBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
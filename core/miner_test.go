@@ -0,0 +1,128 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"blockchain/wallet"
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 目标值为1的区块几乎不可能挖出，Mine只会在被取消时返回
+func impossibleBlock(t *testing.T) *Block {
+	t.Helper()
+
+	coinbase := transaction.NewCoinbaseTX(string(wallet.NewWallet().GetAddress()), "", 1, 0)
+	return newUnminedBlock([]*transaction.Transaction{coinbase}, []byte("parent"), 1, BigToCompact(big.NewInt(1)), time.Now().Unix())
+}
+
+func TestMinerCancellation(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expiring, cancelExpiring := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelExpiring()
+	later, cancelLater := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancelLater)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want error
+	}{
+		{"cancelled before mining", cancelled, context.Canceled},
+		{"deadline", expiring, context.DeadlineExceeded},
+		{"cancelled while mining", later, context.Canceled},
+	}
+	for _, test := range tests {
+		miner := &Miner{Workers: 4}
+		block := impossibleBlock(t)
+		done := make(chan error, 1)
+		go func() { done <- miner.Mine(test.ctx, block) }()
+
+		// 所有goroutine都要在一批哈希之内发现被取消
+		select {
+		case err := <-done:
+			if !errors.Is(err, test.want) {
+				t.Errorf("%s: Mine() = %v, want %v", test.name, err, test.want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Mine() did not return after cancellation", test.name)
+		}
+	}
+}
+
+func TestMinerReportsHashrate(t *testing.T) {
+	reports := make(chan float64, 100)
+	miner := &Miner{
+		Workers:        4,
+		ReportInterval: 20 * time.Millisecond,
+		OnHashrate: func(hashesPerSecond float64) {
+			select {
+			case reports <- hashesPerSecond:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	block := impossibleBlock(t)
+	done := make(chan error, 1)
+	go func() { done <- miner.Mine(ctx, block) }()
+
+	// 各个goroutine每计算一批哈希才累计一次，某个报告周期内可能还没有累计，但很快就会报告出算力
+	deadline := time.After(5 * time.Second)
+	for reported := false; !reported; {
+		select {
+		case rate := <-reports:
+			if rate < 0 {
+				t.Fatalf("hashrate = %f, want >= 0", rate)
+			}
+			reported = rate > 0
+		case <-deadline:
+			t.Fatal("no positive hashrate report")
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Mine() = %v, want %v", err, context.Canceled)
+	}
+}
+
+// 矿工在自己的goroutine中报告算力，挖矿服务的状态可以同时在其他goroutine中读取
+func TestMiningServiceHashrate(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	miner := &Miner{Workers: 2, ReportInterval: 10 * time.Millisecond}
+	s := NewMiningService(bc, address, miner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	block := impossibleBlock(t)
+	done := make(chan error, 1)
+	go func() { done <- miner.Mine(ctx, block) }()
+
+	// 每个读取者都要看到矿工goroutine报告的算力
+	var wg sync.WaitGroup
+	rates := make([]float64, 4)
+	for i := range rates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			deadline := time.Now().Add(5 * time.Second)
+			for rates[i] == 0 && time.Now().Before(deadline) {
+				rates[i] = s.Status().Hashrate
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+	cancel()
+	<-done
+
+	for i, rate := range rates {
+		if rate <= 0 {
+			t.Fatalf("reader %d: Status().Hashrate = %f, want > 0", i, rate)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 挖矿出错（读取主链末端失败、挖出的区块被拒绝）后等待多久再重试
+var miningRetryDelay = 10 * time.Second
+
+// 串行执行消息处理和挖矿服务对区块链、交易池的读写
+var chainLock sync.Mutex
+
+// MiningService 在后台不断地从主链末端和交易池构建区块模板并挖矿。
+// 交易池为空时挖只有coinbase交易的区块；主链末端变化时放弃当前的区块，从新的末端重新开始
+type MiningService struct {
+	bc      *Blockchain
+	address string
+	miner   *Miner
+
+	mu       sync.Mutex
+	running  bool
+	stop     context.CancelFunc
+	restart  context.CancelFunc
+	done     chan struct{}
+	height   int
+	mined    int
+	hashrate float64
+	lastErr  string
+	failures int
+}
+
+// MiningStatus 是挖矿服务的状态
+type MiningStatus struct {
+	Running bool
+	Address string
+	// 正在挖的区块的高度
+	Height int
+	// 服务启动以来挖出并加入主链的区块数
+	BlocksMined int
+	// 最近一次统计的每秒哈希次数
+	Hashrate float64
+	// 最近一次挖矿出错的原因，之后成功挖出区块时清空
+	LastError string
+}
+
+// NewMiningService 创建挖矿服务，奖励发给address。miner的OnHashrate会被服务替换，用于统计算力
+func NewMiningService(bc *Blockchain, address string, miner *Miner) *MiningService {
+	s := &MiningService{bc: bc, address: address, miner: miner}
+	miner.OnHashrate = func(hashrate float64) {
+		s.mu.Lock()
+		s.hashrate = hashrate
+		s.mu.Unlock()
+	}
+
+	return s
+}
+
+// Start starts mining in a background goroutine. It does nothing if the service is already running
+func (s *MiningService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.running = true
+	s.stop = stop
+	s.done = make(chan struct{})
+
+	go s.loop(ctx, s.done)
+}
+
+// Stop stops mining and waits for the background goroutine to exit. The block being mined is discarded
+func (s *MiningService) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	s.stop()
+	done := s.done
+	s.mu.Unlock()
+
+	<-done
+}
+
+// Status returns the current state of the service
+func (s *MiningService) Status() MiningStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return MiningStatus{s.running, s.address, s.height, s.mined, s.hashrate, s.lastErr}
+}
+
+// NotifyNewTip makes the service abandon the block it is mining and start again from the current tip
+func (s *MiningService) NotifyNewTip() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.restart != nil {
+		s.restart()
+	}
+}
+
+func (s *MiningService) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for ctx.Err() == nil {
+		roundCtx, restart := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.restart = restart
+		s.mu.Unlock()
+
+		err := s.mineRound(roundCtx)
+		if err != nil {
+			s.mu.Lock()
+			s.lastErr = err.Error()
+			s.failures++
+			s.mu.Unlock()
+
+			// 等待一段时间再重试，避免出错时不停地重试占满CPU。期间收到新的区块或者服务停止时立即结束等待
+			fmt.Printf("Mining failed: %s, retrying in %s\n", err, miningRetryDelay)
+			select {
+			case <-roundCtx.Done():
+			case <-time.After(miningRetryDelay):
+			}
+		}
+		restart()
+	}
+}
+
+// 从当前的主链末端挖一个区块。挖矿期间主链末端变化或者服务停止时放弃这个区块，不算出错
+func (s *MiningService) mineRound(ctx context.Context) error {
+	chainLock.Lock()
+	tip := s.bc.Tip
+	parent, err := s.bc.GetBlock(tip)
+	if err != nil {
+		chainLock.Unlock()
+		return fmt.Errorf("cannot read tip %x: %w", tip, err)
+	}
+
+	var pending []*transaction.Transaction
+	for id := range mempool {
+		tx := mempool[id]
+		pending = append(pending, &tx)
+	}
+
+	// 按手续费率挑选交易，第一笔是coinbase交易，没有可打包的交易时只有coinbase交易
+	txs := s.bc.NewBlockTemplate(pending, s.address)
+	block := newUnminedBlock(txs, parent.Hash, parent.Height+1, s.bc.nextBits(&parent), s.bc.nextTimestamp(&parent))
+	chainLock.Unlock()
+
+	s.mu.Lock()
+	s.height = block.Height
+	s.mu.Unlock()
+
+	err = s.miner.Mine(ctx, block)
+	if err != nil {
+		return nil
+	}
+
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
+	// 挖矿期间收到了新的区块
+	if bytes.Compare(s.bc.Tip, tip) != 0 {
+		return nil
+	}
+
+	err = s.bc.AddBlock(block)
+	if err != nil {
+		return fmt.Errorf("mined block %x is rejected: %w", block.Hash, err)
+	}
+
+	s.mu.Lock()
+	s.mined++
+	s.lastErr = ""
+	s.mu.Unlock()
+
+	fmt.Printf("New block %x is mined at height %d with %d transaction(s)\n", block.Hash, block.Height, len(txs))
+
+	for _, node := range KnownNodes {
+		if node != nodeAddress {
+			sendInv(node, "block", [][]byte{block.Hash})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试中挖出的区块不广播出去：发送失败会把节点从KnownNodes中删掉，影响后面的测试
+func withoutPeers(t *testing.T) {
+	knownNodes := KnownNodes
+	KnownNodes = nil
+	t.Cleanup(func() { KnownNodes = knownNodes })
+}
+
+// 在临时目录中启动控制socket，返回它的路径
+func startTestControl(t *testing.T) string {
+	t.Helper()
+
+	addr := filepath.Join(t.TempDir(), "node.sock")
+	ln, err := net.Listen(controlNetwork, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go serveControl(ln)
+
+	return addr
+}
+
+func TestMiningControlCommands(t *testing.T) {
+	bc, _, address := newTestChain(t)
+
+	withoutPeers(t)
+	defer func() { miningService = nil }()
+
+	addr := startTestControl(t)
+
+	// 没有开启挖矿的节点回复空的状态
+	status, err := requestMiningControl(addr, "miningstatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running || status.Address != "" {
+		t.Fatalf("status without mining = %+v", status)
+	}
+
+	miningService = NewMiningService(bc, address, &Miner{})
+	miningService.Start()
+
+	status, err = requestMiningControl(addr, "miningstatus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.Address != address {
+		t.Fatalf("status = %+v, want running for %s", status, address)
+	}
+
+	status, err = requestMiningControl(addr, "stopmining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running {
+		t.Fatalf("status after stopmining = %+v, want stopped", status)
+	}
+	if miningService.Status().Running {
+		t.Fatal("mining service is still running")
+	}
+
+	// 停止后可以重新开始
+	status, err = requestMiningControl(addr, "startmining")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running {
+		t.Fatalf("status after startmining = %+v, want running", status)
+	}
+	miningService.Stop()
+}
+
+func TestMiningControlIsNotServedOnP2PPort(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	withoutPeers(t)
+
+	defer func() { miningService = nil }()
+	miningService = NewMiningService(bc, address, &Miner{})
+	miningService.Start()
+	defer miningService.Stop()
+
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			handleConnection(conn, bc)
+		}
+		close(done)
+	}()
+
+	conn, err := net.Dial(protocol, ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write(commandToBytes("stopmining"))
+	conn.Close()
+	<-done
+
+	if !miningService.Status().Running {
+		t.Fatal("stopmining on the P2P port stopped the miner")
+	}
+}
+
+func TestMiningServiceBacksOffOnError(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	withoutPeers(t)
+
+	retryDelay := miningRetryDelay
+	miningRetryDelay = time.Hour
+	defer func() { miningRetryDelay = retryDelay }()
+
+	// 主链末端指向不存在的区块，每一轮都会出错
+	bc.Tip = []byte("missing")
+	s := NewMiningService(bc, address, &Miner{})
+	s.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().LastError == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("mining service did not report the error")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	s.mu.Lock()
+	failures := s.failures
+	s.mu.Unlock()
+	if failures != 1 {
+		t.Fatalf("failures = %d, want 1 while waiting to retry", failures)
+	}
+
+	// 等待重试期间服务可以立即停止
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not return while waiting to retry")
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"blockchain/util"
+	"log"
+)
+
+const dataIndexBucket = "dataindex"
+
+// DataRecord 记录主链上一个携带数据的输出的位置
+type DataRecord struct {
+	TxID      []byte
+	Vout      int
+	Height    int
+	BlockHash []byte
+	Timestamp int64
+}
+
+// 数据索引中每个数据输出一个键：数据、区块高度、交易ID、输出序号，值是区块哈希和时间戳。
+// 相同数据的记录在桶中相邻，并按区块高度排列
+func dataRecordKey(data []byte, record DataRecord) []byte {
+	var e util.Encoder
+
+	e.WriteBytes(data)
+	e.WriteInt64(int64(record.Height))
+	e.WriteBytes(record.TxID)
+	e.WriteInt64(int64(record.Vout))
+
+	return e.Bytes()
+}
+
+// 携带data的所有记录的键的公共前缀
+func dataRecordPrefix(data []byte) []byte {
+	var e util.Encoder
+	e.WriteBytes(data)
+
+	return e.Bytes()
+}
+
+// 由记录的键和值还原记录
+func decodeDataRecord(key, value []byte) (DataRecord, error) {
+	var record DataRecord
+
+	d := util.NewDecoder(key)
+	d.ReadBytes()
+	record.Height = int(d.ReadInt64())
+	record.TxID = d.ReadBytes()
+	record.Vout = int(d.ReadInt64())
+	err := d.Finish()
+	if err != nil {
+		return record, err
+	}
+
+	d = util.NewDecoder(value)
+	record.BlockHash = d.ReadBytes()
+	record.Timestamp = d.ReadInt64()
+
+	return record, d.Finish()
+}
+
+func encodeDataRecordValue(record DataRecord) []byte {
+	var e util.Encoder
+	e.WriteBytes(record.BlockHash)
+	e.WriteInt64(record.Timestamp)
+
+	return e.Bytes()
+}
+
+// 在主链上查找携带data的数据输出，从最新的区块到创世区块。
+// 区块的时间戳说明data在这个时间之前已经存在
+func (bc *Blockchain) FindData(data []byte) []DataRecord {
+	var records []DataRecord
+
+	err := bc.DB.View(func(tx StoreTx) error {
+		records = tx.GetDataRecords(data)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+
+	return records
+}
+
+// 区块中的交易携带的数据和对应的记录
+func blockDataRecords(block *Block, fn func(data []byte, record DataRecord) error) error {
+	for _, tx := range block.Transactions {
+		for outIdx, out := range tx.Vout {
+			if data, ok := out.Data(); ok {
+				err := fn(data, DataRecord{tx.ID, outIdx, block.Height, block.Hash, block.Timestamp})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// 将区块中的数据输出写入索引
+func indexData(tx StoreTx, block *Block) error {
+	return blockDataRecords(block, tx.PutDataRecord)
+}
+
+// 从索引中删除区块中的数据输出
+func unindexData(tx StoreTx, block *Block) error {
+	return blockDataRecords(block, tx.DeleteDataRecord)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"blockchain/script"
+	"blockchain/transaction"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDataOutputSanity(t *testing.T) {
+	oversized := script.NewBuilder().AddOp(script.OP_RETURN).AddData(bytes.Repeat([]byte{1}, script.MaxDataSize+1)).Script()
+
+	tests := []struct {
+		name string
+		out  transaction.TXOutput
+		want error
+	}{
+		{"data output", *transaction.NewDataTXOutput([]byte("document hash")), nil},
+		{"largest data output", *transaction.NewDataTXOutput(bytes.Repeat([]byte{1}, script.MaxDataSize)), nil},
+		{"data output with value", transaction.TXOutput{Value: 1, ScriptPubKey: transaction.NewDataTXOutput([]byte("document hash")).ScriptPubKey}, ErrDataOutputValue},
+		{"oversized data output", transaction.TXOutput{Value: 0, ScriptPubKey: oversized}, ErrBadDataOutput},
+	}
+	for _, test := range tests {
+		tx := transaction.Transaction{
+			Vin:  []transaction.TXInput{{Txid: bytes.Repeat([]byte{1}, 32), Vout: 0, Sequence: transaction.MaxSequence}},
+			Vout: []transaction.TXOutput{test.out},
+		}
+		tx.ID = tx.Hash()
+		if err := checkTxSanity(&tx); !errors.Is(err, test.want) {
+			t.Errorf("%s: checkTxSanity() = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestFindData(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+	mempool = make(map[string]transaction.Transaction)
+	defer func() { mempool = make(map[string]transaction.Transaction) }()
+
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("document hash")
+	sendData := func() *transaction.Transaction {
+		u := UTXOSet{bc}
+		return NewUTXOTransaction(w, address, 1, 1, 0, data, &u)
+	}
+
+	first := mineOn(t, bc, &genesis, address, sendData())
+	mustAddBlock(t, bc, first)
+	second := mineOn(t, bc, first, address, sendData())
+	mustAddBlock(t, bc, second)
+
+	// 从最新的区块到创世区块排列
+	records := bc.FindData(data)
+	if len(records) != 2 {
+		t.Fatalf("FindData() returned %d records, want 2", len(records))
+	}
+	for i, block := range []*Block{second, first} {
+		record := records[i]
+		tx := block.Transactions[1]
+		if !bytes.Equal(record.BlockHash, block.Hash) || record.Height != block.Height || record.Timestamp != block.Timestamp || !bytes.Equal(record.TxID, tx.ID) {
+			t.Fatalf("record %d = %+v, want block %x tx %x", i, record, block.Hash, tx.ID)
+		}
+		if out, ok := tx.Vout[record.Vout].Data(); !ok || !bytes.Equal(out, data) {
+			t.Fatalf("record %d points at output %d which does not carry the data", i, record.Vout)
+		}
+	}
+	if records := bc.FindData([]byte("document")); len(records) != 0 {
+		t.Fatalf("FindData() matched a prefix of the data: %+v", records)
+	}
+
+	// 切换到更长的分支后，被断开的区块中的数据不再能找到
+	fork := mineOn(t, bc, first, address)
+	mustAddBlock(t, bc, fork)
+	mustAddBlock(t, bc, mineOn(t, bc, fork, address))
+	records = bc.FindData(data)
+	if len(records) != 1 || !bytes.Equal(records[0].BlockHash, first.Hash) {
+		t.Fatalf("FindData() after reorganization = %+v, want only the record in block %x", records, first.Hash)
+	}
+}
@@ -3,70 +3,31 @@ package core
 import (
 	"math/big"
 	"bytes"
-	"blockchain/util"
-	"fmt"
-	"math"
 	"crypto/sha256"
 )
 
-// 区块哈希值前面至少有targetBits个0
-const targetBits = 24
-const maxNonce = math.MaxInt64
+// 最低难度：区块哈希值前面至少有TargetBits个0。测试时可以调低，必须在创建或打开区块链之前设置
+var TargetBits = 24
 
 type ProofOfWork struct {
 	block *Block
 	target *big.Int
 }
 
-// 设置区块b和target
+// 设置区块b和target，target由区块中记录的难度Bits得到
 func NewProofOfWork(b *Block) *ProofOfWork {
-	// 计算哈希使用的是SHA-256算法，哈希值一共256位
-	target := big.NewInt(1)
-	// 1左移256-targetBits位
-	target.Lsh(target, uint(256 - targetBits))
+	target := CompactToBig(b.Bits)
 
 	pow := &ProofOfWork{b, target}
 	return pow
 }
 
-func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			util.IntToHex(pow.block.Timestamp),
-			util.IntToHex(int64(targetBits)),
-			util.IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
+// 只对区块头计算哈希，交易已经包含在区块头的MerkleRoot中
+func (pow *ProofOfWork) prepareData(nonce uint32) []byte {
+	header := pow.block.Header()
+	header.Nonce = nonce
 
-	return data
-}
-
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var hashInt big.Int
-	// 256位哈希，即32比特
-	var hash [32]byte
-	nonce := 0
-
-	fmt.Printf("Mining a new block")
-	for nonce < maxNonce {
-		data := pow.prepareData(nonce)
-		hash = sha256.Sum256(data)
-		// 为了方便和target比较，将hash转为big.Int
-		hashInt.SetBytes(hash[:])
-
-		if hashInt.Cmp(pow.target) == -1 {
-		    fmt.Printf("\r%x", hash)
-			break
-		} else {
-			nonce++
-		}
-	}
-	fmt.Print("\n\n")
-
-	return nonce, hash[:]
+	return header.Serialize()
 }
 
 // 工作量证明
@@ -77,7 +38,16 @@ func (pow *ProofOfWork) Validate() bool {
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
 
-	isValid := hashInt.Cmp(pow.target) == -1
+	// 区块中记录的哈希必须就是实际计算出的哈希
+	isValid := hashInt.Cmp(pow.target) == -1 && bytes.Compare(hash[:], pow.block.Hash) == 0
 
 	return isValid
 }
+
+// 区块的工作量：平均需要尝试 2^256 / (target+1) 次哈希才能找到满足条件的nonce
+func (pow *ProofOfWork) Work() *big.Int {
+	denominator := new(big.Int).Add(pow.target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+
+	return numerator.Div(numerator, denominator)
+}
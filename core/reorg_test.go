@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"blockchain/transaction"
+)
+
+// 在parent上挖一个包含txs的区块，coinbase交易由函数生成。parent可以不在主链末端
+func mineOn(t *testing.T, bc *Blockchain, parent *Block, address string, txs ...*transaction.Transaction) *Block {
+	t.Helper()
+
+	coinbase := transaction.NewCoinbaseTX(address, hex.EncodeToString(parent.Hash[:4]), parent.Height+1, 0)
+	all := append([]*transaction.Transaction{coinbase}, txs...)
+	block := newUnminedBlock(all, parent.Hash, parent.Height+1, bc.nextBits(parent), bc.nextTimestamp(parent))
+	if err := DefaultMiner.Mine(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+func mustAddBlock(t *testing.T, bc *Blockchain, block *Block) {
+	t.Helper()
+
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock(%x) = %v", block.Hash, err)
+	}
+}
+
+// 创建一条测试链，交易池在测试结束后清空，coinbase输出可以立即花费
+func newReorgTestChain(t *testing.T) (*Blockchain, *Block, func(amount int) *transaction.Transaction, string) {
+	t.Helper()
+
+	bc, w, address := newTestChain(t)
+
+	maturity := CoinbaseMaturity
+	CoinbaseMaturity = 0
+	mempool = make(map[string]transaction.Transaction)
+	t.Cleanup(func() {
+		CoinbaseMaturity = maturity
+		mempool = make(map[string]transaction.Transaction)
+	})
+
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := func(amount int) *transaction.Transaction {
+		u := UTXOSet{bc}
+		return NewUTXOTransaction(w, address, amount, 1, 0, nil, &u)
+	}
+
+	return bc, &genesis, spend, address
+}
+
+func TestReorganizeToHeavierBranch(t *testing.T) {
+	bc, genesis, spend, address := newReorgTestChain(t)
+
+	tx := spend(3)
+	a1 := mineOn(t, bc, genesis, address, tx)
+	mustAddBlock(t, bc, a1)
+
+	// 工作量相同的分支只作为侧链保存
+	b1 := mineOn(t, bc, genesis, address)
+	mustAddBlock(t, bc, b1)
+	if !bytes.Equal(bc.Tip, a1.Hash) {
+		t.Fatalf("tip = %x after an equal-work branch, want %x", bc.Tip, a1.Hash)
+	}
+
+	b2 := mineOn(t, bc, b1, address)
+	mustAddBlock(t, bc, b2)
+	if !bytes.Equal(bc.Tip, b2.Hash) {
+		t.Fatalf("tip = %x, want the heavier branch %x", bc.Tip, b2.Hash)
+	}
+	if bc.GetBestHeight() != 2 {
+		t.Fatalf("best height = %d, want 2", bc.GetBestHeight())
+	}
+	main, err := bc.GetBlockByHeight(1)
+	if err != nil || !bytes.Equal(main.Hash, b1.Hash) {
+		t.Fatalf("block at height 1 = %x, want %x", main.Hash, b1.Hash)
+	}
+
+	// 旧分支上的交易回到交易池，它的输出不在UTXO集中，它花费的输出重新可用
+	if _, ok := mempool[hex.EncodeToString(tx.ID)]; !ok {
+		t.Fatal("transaction of the detached block is not back in the mempool")
+	}
+	u := UTXOSet{bc}
+	if u.GetEntry(tx.ID, 0) != nil {
+		t.Fatal("output of the detached transaction is still in the UTXO set")
+	}
+	if u.GetEntry(tx.Vin[0].Txid, tx.Vin[0].Vout) == nil {
+		t.Fatal("output spent by the detached transaction is not restored")
+	}
+	if _, err := bc.CheckMempoolTransaction(tx); err != nil {
+		t.Fatalf("detached transaction cannot be mined again: %v", err)
+	}
+}
+
+func TestFailedReorganizeRestoresOldTip(t *testing.T) {
+	bc, genesis, spend, address := newReorgTestChain(t)
+
+	// 两笔交易花费同一个输出，分别进入两个分支
+	tx := spend(3)
+	conflict := spend(4)
+
+	a1 := mineOn(t, bc, genesis, address, tx)
+	mustAddBlock(t, bc, a1)
+
+	pending := spend(2)
+	mempool[hex.EncodeToString(pending.ID)] = *pending
+
+	// b2花费不存在的输出，侧链上的区块在切换主链时才检查输入
+	missing := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: []byte("missing"), Vout: 0, Sequence: transaction.MaxSequence}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(1, address)},
+	}
+	trimmed := missing.TrimmedCopy()
+	missing.ID = trimmed.Hash()
+
+	b1 := mineOn(t, bc, genesis, address, conflict)
+	mustAddBlock(t, bc, b1)
+	b2 := mineOn(t, bc, b1, address, missing)
+	if err := bc.AddBlock(b2); !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("AddBlock(b2) = %v, want %v", err, ErrMissingInput)
+	}
+
+	if !bytes.Equal(bc.Tip, a1.Hash) {
+		t.Fatalf("tip = %x after a failed reorganization, want %x", bc.Tip, a1.Hash)
+	}
+	main, err := bc.GetBlockByHeight(1)
+	if err != nil || !bytes.Equal(main.Hash, a1.Hash) {
+		t.Fatalf("block at height 1 = %x, want %x", main.Hash, a1.Hash)
+	}
+	u := UTXOSet{bc}
+	if u.GetEntry(tx.ID, 0) == nil || u.GetEntry(conflict.ID, 0) != nil {
+		t.Fatal("UTXO set is not restored to the old main chain")
+	}
+
+	// 交易池恢复原状，无效分支上的交易没有进入交易池
+	if len(mempool) != 1 {
+		t.Fatalf("mempool has %d transactions, want 1", len(mempool))
+	}
+	if _, ok := mempool[hex.EncodeToString(pending.ID)]; !ok {
+		t.Fatal("pending transaction was lost")
+	}
+
+	// 再次收到无效的区块或者它的后代时直接拒绝
+	if err := bc.AddBlock(b2); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("AddBlock(b2) again = %v, want %v", err, ErrInvalidBlock)
+	}
+	b3 := mineOn(t, bc, b2, address)
+	if err := bc.AddBlock(b3); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("AddBlock(b3) = %v, want %v", err, ErrInvalidBlock)
+	}
+	if !bytes.Equal(bc.Tip, a1.Hash) {
+		t.Fatalf("tip = %x, want %x", bc.Tip, a1.Hash)
+	}
+}
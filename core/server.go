@@ -21,6 +21,8 @@ var miningAddress string
 var KnownNodes = []string{"localhost:3000"}
 var blocksInTransit = [][]byte{}
 var mempool = make(map[string]transaction.Transaction)
+// 设置了挖矿地址时由StartServer创建
+var miningService *MiningService
 
 type addr struct {
 	AddrList []string
@@ -33,6 +35,7 @@ type block struct {
 
 type getblocks struct {
 	AddrFrom string
+	Locator  [][]byte
 }
 
 type getdata struct {
@@ -56,6 +59,8 @@ type version struct {
 	Version    int
 	BestHeight int
 	AddrFrom   string
+	// 发送方的本机时间，用于调整节点时间
+	Timestamp  int64
 }
 
 func StartServer(nodeID, minerAddress string) {
@@ -73,6 +78,19 @@ func StartServer(nodeID, minerAddress string) {
 		sendVersion(KnownNodes[0], bc)
 	}
 
+	if len(miningAddress) > 0 {
+		miningService = NewMiningService(bc, miningAddress, &Miner{})
+		miningService.Start()
+	}
+
+	// 挖矿控制命令只在本机的Unix socket上接受，P2P端口上的节点不能控制挖矿
+	control, err := listenControl(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer control.Close()
+	go serveControl(control)
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -84,7 +102,7 @@ func StartServer(nodeID, minerAddress string) {
 
 func sendVersion(addr string, bc *Blockchain) {
 	bestHeight := bc.GetBestHeight()
-	payload := gobEncode(version{nodeVersion, bestHeight, nodeAddress})
+	payload := gobEncode(version{nodeVersion, bestHeight, nodeAddress, SystemTime.Now()})
 
 	request := append(commandToBytes("version"), payload...)
 
@@ -127,15 +145,21 @@ func commandToBytes(command string) []byte {
 
 func handleConnection(conn net.Conn, bc *Blockchain) {
 	request, err := ioutil.ReadAll(conn)
-	if err != nil {
-		log.Panic(err)
+	if err != nil || len(request) < commandLength {
+		fmt.Printf("Dropped malformed message: %v\n", err)
+		conn.Close()
+		return
 	}
 	command := bytesToCommand(request[:commandLength])
 	fmt.Printf("Received %s command\n", command)
 
+	// 和挖矿服务互斥地访问区块链和交易池
+	chainLock.Lock()
+	defer chainLock.Unlock()
+
 	switch command {
 	case "addr":
-		handleAddr(request)
+		handleAddr(request, bc)
 	case "block":
 		handleBlock(request, bc)
 	case "inv":
@@ -147,7 +171,7 @@ func handleConnection(conn net.Conn, bc *Blockchain) {
 	case "tx":
 		handleTx(request, bc)
 	case "version":
-		handleVersion(request, bc)
+		handleVersion(request, bc, peerHost(conn.RemoteAddr()))
 	default:
 		fmt.Println("Unknown command!")
 	}
@@ -179,7 +203,7 @@ func bytesToCommand(bytes []byte) string {
 	return fmt.Sprintf("%s", command)
 }
 
-func handleAddr(request []byte) {
+func handleAddr(request []byte, bc *Blockchain) {
 	var buff bytes.Buffer
 	var payload addr
 
@@ -187,12 +211,13 @@ func handleAddr(request []byte) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
 	KnownNodes = append(KnownNodes, payload.AddrList...)
 	fmt.Printf("There are %d known nodes now!\n", len(KnownNodes))
-	requestBlocks()
+	requestBlocks(bc)
 }
 
 func handleBlock(request []byte, bc *Blockchain) {
@@ -203,25 +228,37 @@ func handleBlock(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
 	blockData := payload.Block
-	block := DeserializeBlock(blockData)
+	// 对方节点发来的数据不可信，解码失败时丢弃消息，不能让节点崩溃
+	block, err := ParseBlock(blockData)
+	if err != nil {
+		fmt.Printf("Dropped malformed block from %s: %s\n", payload.AddrFrom, err)
+		return
+	}
 
 	fmt.Println("Recevied a new block!")
-	bc.AddBlock(block)
+	tip := bc.Tip
+	err = bc.AddBlock(block)
+	if err != nil {
+		fmt.Printf("Rejected block %x: %s\n", block.Hash, err)
+	} else {
+		fmt.Printf("Added block %x\n", block.Hash)
+	}
 
-	fmt.Printf("Added block %x\n", block.Hash)
+	// 主链末端变化后，正在挖的区块已经过时
+	if miningService != nil && bytes.Compare(tip, bc.Tip) != 0 {
+		miningService.NotifyNewTip()
+	}
 
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
 		sendGetData(payload.AddrFrom, "block", blockHash)
 
 		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := UTXOSet{bc}
-		UTXOSet.Reindex()
 	}
 }
 
@@ -240,7 +277,8 @@ func handleInv(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
 	fmt.Printf("Recevied inventory with %d %s\n", len(payload.Items), payload.Type)
@@ -277,10 +315,16 @@ func handleGetBlocks(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
-	blocks := bc.GetBlockHashes()
+	// 只发送双方分叉点之后的区块，按高度从低到高排列，对方可以依次验证并连接
+	fork := bc.findLocatorFork(payload.Locator)
+	blocks := bc.GetBlockHashesRange(fork+1, bc.GetBestHeight())
+	if len(blocks) == 0 {
+		return
+	}
 	sendInv(payload.AddrFrom, "block", blocks)
 }
 
@@ -300,7 +344,8 @@ func handleGetData(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
 	if payload.Type == "block" {
@@ -345,12 +390,25 @@ func handleTx(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
 	}
 
 	txData := payload.Transaction
-	tx := transaction.DeserializeTransaction(txData)
+	tx, err := transaction.ParseTransaction(txData)
+	if err != nil {
+		fmt.Printf("Dropped malformed transaction from %s: %s\n", payload.AddFrom, err)
+		return
+	}
+
+	// 不能打包进下一个区块的交易不能进入交易池；锁定时间未到、花费交易池中其他交易的输出的交易到期后需要重新发送
+	fee, err := bc.CheckMempoolTransaction(&tx)
+	if err != nil {
+		fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+		return
+	}
 	mempool[hex.EncodeToString(tx.ID)] = tx
+	fmt.Printf("Accepted transaction %x paying %d fee\n", tx.ID, fee)
 
 	if nodeAddress == KnownNodes[0] {
 		for _, node := range KnownNodes {
@@ -358,51 +416,25 @@ func handleTx(request []byte, bc *Blockchain) {
 				sendInv(node, "tx", [][]byte{tx.ID})
 			}
 		}
-	} else {
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*transaction.Transaction
-
-			for id := range mempool {
-				tx := mempool[id]
-				if bc.VerifyTransaction(&tx) {
-					txs = append(txs, &tx)
-				}
-			}
-
-			if len(txs) == 0 {
-				fmt.Println("All transactions are invalid! Waiting for new ones...")
-				return
-			}
-
-			cbTx := transaction.NewCoinbaseTX(miningAddress, "")
-			txs = append(txs, cbTx)
-
-			newBlock := bc.MineBlock(txs)
-			UTXOSet := UTXOSet{bc}
-			UTXOSet.Reindex()
-
-			fmt.Println("New block is mined!")
-
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
-
-			for _, node := range KnownNodes {
-				if node != nodeAddress {
-					sendInv(node, "block", [][]byte{newBlock.Hash})
-				}
-			}
+	}
+	// 让挖矿服务放弃当前的区块模板，重新构建包含新交易的模板
+	if miningService != nil {
+		miningService.NotifyNewTip()
+	}
+}
 
-			if len(mempool) > 0 {
-				goto MineTransactions
-			}
-		}
+// 连接对方的主机地址，不含端口：同一个节点每次连接使用的端口都不同
+func peerHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
 	}
+
+	return host
 }
 
-func handleVersion(request []byte, bc *Blockchain) {
+// peer是连接对方的地址。version消息中的AddrFrom由对方随意填写，不能用来区分时间样本
+func handleVersion(request []byte, bc *Blockchain, peer string) {
 	var buff bytes.Buffer
 	var payload version
 
@@ -410,14 +442,19 @@ func handleVersion(request []byte, bc *Blockchain) {
 	dec := gob.NewDecoder(&buff)
 	err := dec.Decode(&payload)
 	if err != nil {
-		log.Panic(err)
+		fmt.Printf("Dropped malformed message: %s\n", err)
+		return
+	}
+
+	if payload.Timestamp > 0 {
+		AdjustedTime.AddSample(peer, payload.Timestamp)
 	}
 
 	myBestHeight := bc.GetBestHeight()
 	foreignerBestHeight := payload.BestHeight
 
 	if myBestHeight < foreignerBestHeight {
-		sendGetBlocks(payload.AddrFrom)
+		sendGetBlocks(payload.AddrFrom, bc)
 	} else if myBestHeight > foreignerBestHeight {
 		sendVersion(payload.AddrFrom, bc)
 	}
@@ -428,14 +465,30 @@ func handleVersion(request []byte, bc *Blockchain) {
 	}
 }
 
-func requestBlocks() {
+// 将断开的区块中的普通交易放回交易池
+func addToMempool(txs []*transaction.Transaction) {
+	for _, tx := range txs {
+		if tx.IsCoinbase() == false {
+			mempool[hex.EncodeToString(tx.ID)] = *tx
+		}
+	}
+}
+
+// 将已经打包进主链的交易移出交易池
+func removeFromMempool(txs []*transaction.Transaction) {
+	for _, tx := range txs {
+		delete(mempool, hex.EncodeToString(tx.ID))
+	}
+}
+
+func requestBlocks(bc *Blockchain) {
 	for _, node := range KnownNodes {
-		sendGetBlocks(node)
+		sendGetBlocks(node, bc)
 	}
 }
 
-func sendGetBlocks(address string) {
-	payload := gobEncode(getblocks{nodeAddress})
+func sendGetBlocks(address string, bc *Blockchain) {
+	payload := gobEncode(getblocks{nodeAddress, bc.GetBlockLocator()})
 	request := append(commandToBytes("getblocks"), payload...)
 
 	sendData(address, request)
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"blockchain/transaction"
+)
+
+// 把request作为一条消息交给handleConnection处理，等待处理结束
+func handleRequest(t *testing.T, bc *Blockchain, request []byte) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		handleConnection(server, bc)
+		close(done)
+	}()
+
+	if _, err := client.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	<-done
+}
+
+func TestMalformedPeerMessagesAreDropped(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	tip := bc.Tip
+
+	blockData := mineTestBlock(t, bc, []*transaction.Transaction{transaction.NewCoinbaseTX(address, "", 1, 0)}).Serialize()
+	txData := transaction.NewCoinbaseTX(address, "", 1, 0).Serialize()
+
+	requests := [][]byte{
+		nil,
+		[]byte("blo"),
+		commandToBytes("block"),
+		append(commandToBytes("block"), 0xff, 0x00),
+		append(commandToBytes("block"), gobEncode(block{"peer", blockData[:len(blockData)-1]})...),
+		append(commandToBytes("block"), gobEncode(block{"peer", append(blockData, 0)})...),
+		append(commandToBytes("tx"), gobEncode(tx{"peer", txData[:10]})...),
+		append(commandToBytes("version"), 0x01),
+	}
+
+	for _, request := range requests {
+		handleRequest(t, bc, request)
+	}
+
+	if string(bc.Tip) != string(tip) {
+		t.Fatal("a malformed block changed the tip")
+	}
+	if len(mempool) != 0 {
+		t.Fatal("a malformed transaction entered the mempool")
+	}
+}
+
+func TestVersionTimeSamplesAreKeyedByConnection(t *testing.T) {
+	bc, _, _ := newTestChain(t)
+	withoutPeers(t)
+
+	adjustedTime := AdjustedTime
+	AdjustedTime = NewMedianTimeSource(SystemTime)
+	defer func() { AdjustedTime = adjustedTime }()
+
+	// 同一个连接对方换着AddrFrom发送version消息，只记录一个时间样本
+	for i := 0; i < minTimeSamples; i++ {
+		payload := gobEncode(version{nodeVersion, bc.GetBestHeight(), fmt.Sprintf("localhost:%d", 4000+i), SystemTime.Now() + 600})
+		handleRequest(t, bc, append(commandToBytes("version"), payload...))
+	}
+	if len(AdjustedTime.offsets) != 1 {
+		t.Fatalf("recorded %d time samples, want 1", len(AdjustedTime.offsets))
+	}
+	if got := AdjustedTime.Offset(); got != 0 {
+		t.Fatalf("Offset() = %d, want 0", got)
+	}
+}
+
+func TestPeerHost(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 52000}
+	if got := peerHost(addr); got != "127.0.0.1" {
+		t.Fatalf("peerHost(%s) = %q, want 127.0.0.1", addr, got)
+	}
+}
+
+// 在genesis上挖length个区块作为主链，返回主链上的所有区块（包括创世区块）
+func extendChain(t *testing.T, bc *Blockchain, address string, length int) []*Block {
+	t.Helper()
+
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := []*Block{&genesis}
+	for i := 0; i < length; i++ {
+		block := mineOn(t, bc, chain[len(chain)-1], address)
+		mustAddBlock(t, bc, block)
+		chain = append(chain, block)
+	}
+
+	return chain
+}
+
+func TestBlockLocator(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	chain := extendChain(t, bc, address, 25)
+
+	// 先是最近的10个区块，之后间隔每次加倍，最后是创世区块
+	var want [][]byte
+	for _, height := range []int{25, 24, 23, 22, 21, 20, 19, 18, 17, 16, 14, 10, 2, 0} {
+		want = append(want, chain[height].Hash)
+	}
+	if got := bc.GetBlockLocator(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetBlockLocator() = %x, want %x", got, want)
+	}
+
+	// 只有创世区块的链
+	bc, _, _ = newTestChain(t)
+	if got := bc.GetBlockLocator(); len(got) != 1 || !bytes.Equal(got[0], bc.Tip) {
+		t.Fatalf("GetBlockLocator() of a genesis-only chain = %x", got)
+	}
+}
+
+func TestFindLocatorFork(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	chain := extendChain(t, bc, address, 5)
+
+	// 从高度2分出的、较短的侧链
+	side3 := mineOn(t, bc, chain[2], address)
+	mustAddBlock(t, bc, side3)
+	side4 := mineOn(t, bc, side3, address)
+	mustAddBlock(t, bc, side4)
+	if !bytes.Equal(bc.Tip, chain[5].Hash) {
+		t.Fatal("the shorter side branch became the main chain")
+	}
+
+	tests := []struct {
+		name    string
+		locator [][]byte
+		want    int
+	}{
+		{"side branch", [][]byte{side4.Hash, side3.Hash, chain[2].Hash, chain[1].Hash, chain[0].Hash}, 2},
+		{"unknown blocks are skipped", [][]byte{[]byte("unknown"), chain[3].Hash, chain[0].Hash}, 3},
+		{"same tip", [][]byte{chain[5].Hash, chain[4].Hash, chain[0].Hash}, 5},
+		{"genesis only", [][]byte{chain[0].Hash}, 0},
+		{"nothing in common", [][]byte{[]byte("unknown")}, -1},
+		{"empty locator", nil, -1},
+	}
+	for _, test := range tests {
+		if got := bc.findLocatorFork(test.locator); got != test.want {
+			t.Errorf("%s: findLocatorFork() = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// 对方在侧链上时，只发送分叉点之后的主链区块，按高度从低到高排列
+func TestHandleGetBlocksSendsBlocksAfterFork(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	chain := extendChain(t, bc, address, 5)
+	side3 := mineOn(t, bc, chain[2], address)
+	mustAddBlock(t, bc, side3)
+
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		request, _ := io.ReadAll(conn)
+		received <- request
+	}()
+
+	locator := [][]byte{side3.Hash, chain[2].Hash, chain[1].Hash, chain[0].Hash}
+	handleRequest(t, bc, append(commandToBytes("getblocks"), gobEncode(getblocks{ln.Addr().String(), locator})...))
+
+	request := <-received
+	if len(request) < commandLength || bytesToCommand(request[:commandLength]) != "inv" {
+		t.Fatalf("peer received %q, want an inv message", request)
+	}
+	var payload inv
+	if err := gob.NewDecoder(bytes.NewReader(request[commandLength:])).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{chain[3].Hash, chain[4].Hash, chain[5].Hash}
+	if payload.Type != "block" || !reflect.DeepEqual(payload.Items, want) {
+		t.Fatalf("inv = %s %x, want block %x", payload.Type, payload.Items, want)
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"bytes"
+)
+
+// TxProof 证明一笔交易包含在主链的某个区块中。
+// 轻客户端只需要保存区块头，就可以用交易和Merkle路径验证，不需要下载整个区块
+type TxProof struct {
+	BlockHash []byte
+	Height    int
+	Header    BlockHeader
+	Tx        transaction.Transaction
+	Proof     MerkleProof
+}
+
+// GetTxProof returns an inclusion proof for a transaction in the main chain
+func (bc *Blockchain) GetTxProof(txID []byte) (*TxProof, error) {
+	block, index, err := bc.findTransactionLocation(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions [][]byte
+	for _, tx := range block.Transactions {
+		transactions = append(transactions, tx.Serialize())
+	}
+
+	proof, err := NewMerkleTree(transactions).Proof(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TxProof{block.Hash, block.Height, block.Header(), *block.Transactions[index], proof}, nil
+}
+
+// Verify checks that the header hashes to BlockHash and that Tx is included under its Merkle root.
+// The caller still has to check that BlockHash is in the main chain it trusts
+func (p *TxProof) Verify() bool {
+	if bytes.Compare(p.Header.Hash(), p.BlockHash) != 0 {
+		return false
+	}
+
+	return VerifyMerkleProof(p.Header.MerkleRoot, p.Tx.Serialize(), p.Proof)
+}
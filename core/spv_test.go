@@ -0,0 +1,79 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"bytes"
+	"testing"
+)
+
+func TestTxProofVerifiesAgainstStoredHeader(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+
+	chain := extendChain(t, bc, address, 1)
+	// 3笔交易，Merkle树的第一层要复制最后一个节点
+	block := mineOn(t, bc, chain[1], address,
+		spendCoinbase(t, w, chain[0].Transactions[0], address),
+		spendCoinbase(t, w, chain[1].Transactions[0], address))
+	mustAddBlock(t, bc, block)
+
+	// 没有交易索引时遍历主链查找，开启索引后从索引查找，得到同样的证明
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			bc.ReindexTransactions()
+		}
+
+		for i, tx := range block.Transactions {
+			proof, err := bc.GetTxProof(tx.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(proof.BlockHash, block.Hash) || proof.Height != block.Height || proof.Proof.Index != i {
+				t.Fatalf("indexed %t: proof of transaction %d points at block %x height %d index %d", indexed, i, proof.BlockHash, proof.Height, proof.Proof.Index)
+			}
+			if !proof.Verify() {
+				t.Fatalf("indexed %t: proof of transaction %d does not verify", indexed, i)
+			}
+
+			// 轻客户端用自己保存的区块头验证，不使用证明中附带的区块头
+			header, err := bc.GetHeader(proof.BlockHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(header.MerkleRoot, tx.Serialize(), proof.Proof) {
+				t.Fatalf("indexed %t: proof of transaction %d does not verify against the stored header", indexed, i)
+			}
+		}
+	}
+
+	valid, err := bc.GetTxProof(block.Transactions[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampers := []struct {
+		name   string
+		tamper func(p *TxProof)
+	}{
+		{"other transaction", func(p *TxProof) { p.Tx = *block.Transactions[2] }},
+		{"changed output", func(p *TxProof) {
+			p.Tx.Vout = []transaction.TXOutput{{Value: p.Tx.Vout[0].Value + 1, ScriptPubKey: p.Tx.Vout[0].ScriptPubKey}}
+		}},
+		{"header of another block", func(p *TxProof) { p.Header = chain[1].Header() }},
+		{"changed Merkle root", func(p *TxProof) { p.Header.MerkleRoot = chain[1].MerkleRoot }},
+		{"wrong index", func(p *TxProof) { p.Proof.Index = 2 }},
+		{"missing sibling", func(p *TxProof) { p.Proof.Siblings = p.Proof.Siblings[1:] }},
+	}
+	for _, test := range tampers {
+		proof := *valid
+		proof.Proof.Siblings = append([][]byte{}, valid.Proof.Siblings...)
+		test.tamper(&proof)
+		if proof.Verify() {
+			t.Errorf("%s: tampered proof verifies", test.name)
+		}
+	}
+
+	if _, err := bc.GetTxProof([]byte("missing")); err == nil {
+		t.Fatal("GetTxProof() of an unknown transaction succeeded")
+	}
+}
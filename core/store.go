@@ -0,0 +1,366 @@
+package core
+
+import (
+	"blockchain/util"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+)
+
+// 数据的存储格式版本。区块、交易和各个索引的编码改变时加1，旧格式的数据库不能直接打开，
+// 需要删除后重新同步或迁移。版本0是没有格式标记的旧数据库（区块用gob编码），版本2增加了数据索引
+const storeFormatVersion = 2
+
+var ErrIncompatibleStore = errors.New("incompatible database, recreate or migrate it")
+
+// Store 是区块链的存储后端。Blockchain、UTXOSet和BlockchainIterator只通过它读写数据，
+// 不直接依赖某个数据库引擎
+type Store interface {
+	// 在只读事务中执行fn
+	View(fn func(tx StoreTx) error) error
+	// 在读写事务中执行fn，fn返回错误时事务中的修改全部丢弃
+	Update(fn func(tx StoreTx) error) error
+	Close() error
+}
+
+// StoreTx 是一次存储事务中可以进行的区块、tip和链状态操作
+type StoreTx interface {
+	// 区块：区块哈希 -> 区块，不存在时返回nil。保存、删除区块时同时保存、删除区块头
+	GetBlock(hash []byte) *Block
+	PutBlock(block *Block) error
+	DeleteBlock(hash []byte) error
+
+	// 区块头：区块哈希 -> 区块头，不存在时返回nil
+	GetHeader(hash []byte) *BlockHeader
+	PutHeader(hash []byte, header BlockHeader) error
+
+	// 数据的存储格式版本，没有格式标记时返回0
+	GetFormatVersion() int
+	PutFormatVersion(version int) error
+
+	// 主链最后一个区块的哈希
+	GetTip() []byte
+	PutTip(hash []byte) error
+
+	// 区块所在分支的累计工作量，不存在时返回0
+	GetChainWork(hash []byte) *big.Int
+	PutChainWork(hash []byte, work *big.Int) error
+	DeleteChainWork(hash []byte) error
+
+	// 主链高度索引：区块高度 -> 主链上该高度的区块哈希，不存在时返回nil
+	GetHashByHeight(height int) []byte
+	PutHashByHeight(height int, hash []byte) error
+	DeleteHashByHeight(height int) error
+
+	// 交易索引：交易ID -> 交易在主链上的位置，不存在时返回nil
+	GetTxLocation(txID []byte) *TxLocation
+	PutTxLocation(txID []byte, loc TxLocation) error
+	DeleteTxLocation(txID []byte) error
+	ClearTxIndex() error
+	IsTxIndexEnabled() bool
+	SetTxIndexEnabled(enabled bool) error
+
+	// 地址索引：公钥哈希 -> 地址的转入、转出记录，每条记录单独保存，不存在时返回空记录
+	GetAddrHistory(pubKeyHash []byte) AddrHistory
+	PutAddrEvent(pubKeyHash []byte, event AddrEvent) error
+	DeleteAddrEvent(pubKeyHash []byte, event AddrEvent) error
+
+	// 数据索引：数据 -> 主链上携带这个数据的输出，按区块高度从低到高排列
+	GetDataRecords(data []byte) []DataRecord
+	PutDataRecord(data []byte, record DataRecord) error
+	DeleteDataRecord(data []byte, record DataRecord) error
+
+	// 链状态（UTXO集）：交易ID:输出序号 -> 未花费输出的条目，不存在时返回nil
+	GetUTXO(txID []byte, vout int) *UTXOEntry
+	PutUTXO(txID []byte, vout int, entry UTXOEntry) error
+	DeleteUTXO(txID []byte, vout int) error
+	ForEachUTXO(fn func(txID []byte, vout int, entry UTXOEntry) error) error
+	ClearUTXO() error
+
+	// 区块的撤销数据：区块哈希 -> 撤销数据，不存在时返回nil
+	GetUndo(hash []byte) *BlockUndo
+	PutUndo(hash []byte, undo BlockUndo) error
+	DeleteUndo(hash []byte) error
+	ClearUndo() error
+}
+
+// bucketTx 是存储引擎需要提供的按桶读写键值的事务，
+// 新的存储引擎只需实现Store和bucketTx
+type bucketTx interface {
+	get(bucket string, key []byte) []byte
+	put(bucket string, key, value []byte) error
+	delete(bucket string, key []byte) error
+	// 按键的字节序遍历桶中的所有键值
+	forEach(bucket string, fn func(k, v []byte) error) error
+	// 按键的字节序遍历桶中以prefix开头的键值
+	forEachPrefix(bucket string, prefix []byte, fn func(k, v []byte) error) error
+	clear(bucket string) error
+}
+
+// storeTx 在bucketTx之上实现StoreTx，负责桶的划分和数据的序列化
+type storeTx struct {
+	bucketTx
+}
+
+func (tx storeTx) GetBlock(hash []byte) *Block {
+	blockData := tx.get(blocksBucket, hash)
+	if blockData == nil {
+		return nil
+	}
+
+	return DeserializeBlock(blockData)
+}
+
+func (tx storeTx) PutBlock(block *Block) error {
+	err := tx.PutHeader(block.Hash, block.Header())
+	if err != nil {
+		return err
+	}
+
+	return tx.put(blocksBucket, block.Hash, block.Serialize())
+}
+
+func (tx storeTx) DeleteBlock(hash []byte) error {
+	err := tx.delete(headerBucket, hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.delete(blocksBucket, hash)
+}
+
+func (tx storeTx) GetHeader(hash []byte) *BlockHeader {
+	headerData := tx.get(headerBucket, hash)
+	if headerData == nil {
+		return nil
+	}
+
+	header := DeserializeBlockHeader(headerData)
+
+	return &header
+}
+
+func (tx storeTx) PutHeader(hash []byte, header BlockHeader) error {
+	return tx.put(headerBucket, hash, header.Serialize())
+}
+
+func (tx storeTx) GetFormatVersion() int {
+	data := tx.get(blocksBucket, []byte("format"))
+	if data == nil {
+		return 0
+	}
+
+	d := util.NewDecoder(data)
+	version := d.ReadUint32()
+	if d.Finish() != nil {
+		return 0
+	}
+
+	return int(version)
+}
+
+func (tx storeTx) PutFormatVersion(version int) error {
+	var e util.Encoder
+	e.WriteUint32(uint32(version))
+
+	return tx.put(blocksBucket, []byte("format"), e.Bytes())
+}
+
+// 检查存储中已有数据的格式版本，与当前版本不同时返回ErrIncompatibleStore
+func checkStoreFormat(store Store) error {
+	return store.View(func(tx StoreTx) error {
+		version := tx.GetFormatVersion()
+		if version != storeFormatVersion {
+			return fmt.Errorf("%w: database format version %d, expected %d", ErrIncompatibleStore, version, storeFormatVersion)
+		}
+
+		return nil
+	})
+}
+
+func (tx storeTx) GetTip() []byte {
+	tip := tx.get(blocksBucket, []byte("l"))
+	if tip == nil {
+		return nil
+	}
+
+	return append([]byte{}, tip...)
+}
+
+func (tx storeTx) PutTip(hash []byte) error {
+	return tx.put(blocksBucket, []byte("l"), hash)
+}
+
+func (tx storeTx) GetChainWork(hash []byte) *big.Int {
+	return new(big.Int).SetBytes(tx.get(chainWorkBucket, hash))
+}
+
+func (tx storeTx) PutChainWork(hash []byte, work *big.Int) error {
+	return tx.put(chainWorkBucket, hash, work.Bytes())
+}
+
+func (tx storeTx) DeleteChainWork(hash []byte) error {
+	return tx.delete(chainWorkBucket, hash)
+}
+
+func (tx storeTx) GetHashByHeight(height int) []byte {
+	hash := tx.get(heightBucket, util.IntToHex(int64(height)))
+	if hash == nil {
+		return nil
+	}
+
+	return append([]byte{}, hash...)
+}
+
+func (tx storeTx) PutHashByHeight(height int, hash []byte) error {
+	return tx.put(heightBucket, util.IntToHex(int64(height)), hash)
+}
+
+func (tx storeTx) DeleteHashByHeight(height int) error {
+	return tx.delete(heightBucket, util.IntToHex(int64(height)))
+}
+
+func (tx storeTx) GetTxLocation(txID []byte) *TxLocation {
+	locData := tx.get(txIndexBucket, txID)
+	if locData == nil {
+		return nil
+	}
+
+	loc := DeserializeTxLocation(locData)
+
+	return &loc
+}
+
+func (tx storeTx) PutTxLocation(txID []byte, loc TxLocation) error {
+	return tx.put(txIndexBucket, txID, loc.Serialize())
+}
+
+func (tx storeTx) DeleteTxLocation(txID []byte) error {
+	return tx.delete(txIndexBucket, txID)
+}
+
+func (tx storeTx) ClearTxIndex() error {
+	return tx.clear(txIndexBucket)
+}
+
+// 交易索引是否开启，和tip一样记录在blocks桶中
+func (tx storeTx) IsTxIndexEnabled() bool {
+	return tx.get(blocksBucket, []byte("txindex")) != nil
+}
+
+func (tx storeTx) SetTxIndexEnabled(enabled bool) error {
+	if enabled {
+		return tx.put(blocksBucket, []byte("txindex"), []byte{1})
+	}
+
+	return tx.delete(blocksBucket, []byte("txindex"))
+}
+
+func (tx storeTx) GetAddrHistory(pubKeyHash []byte) AddrHistory {
+	var history AddrHistory
+
+	err := tx.forEachPrefix(addrIndexBucket, addrEventPrefix(pubKeyHash), func(k, v []byte) error {
+		event, err := decodeAddrEvent(k, v)
+		if err != nil {
+			return err
+		}
+		history.Events = append(history.Events, event)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return history
+}
+
+func (tx storeTx) PutAddrEvent(pubKeyHash []byte, event AddrEvent) error {
+	return tx.put(addrIndexBucket, addrEventKey(pubKeyHash, event), encodeAddrEventValue(event))
+}
+
+func (tx storeTx) DeleteAddrEvent(pubKeyHash []byte, event AddrEvent) error {
+	return tx.delete(addrIndexBucket, addrEventKey(pubKeyHash, event))
+}
+
+func (tx storeTx) GetDataRecords(data []byte) []DataRecord {
+	var records []DataRecord
+
+	err := tx.forEachPrefix(dataIndexBucket, dataRecordPrefix(data), func(k, v []byte) error {
+		record, err := decodeDataRecord(k, v)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return records
+}
+
+func (tx storeTx) PutDataRecord(data []byte, record DataRecord) error {
+	return tx.put(dataIndexBucket, dataRecordKey(data, record), encodeDataRecordValue(record))
+}
+
+func (tx storeTx) DeleteDataRecord(data []byte, record DataRecord) error {
+	return tx.delete(dataIndexBucket, dataRecordKey(data, record))
+}
+
+func (tx storeTx) GetUTXO(txID []byte, vout int) *UTXOEntry {
+	entryData := tx.get(utxoBucket, outpointKey(txID, vout))
+	if entryData == nil {
+		return nil
+	}
+
+	entry := DeserializeUTXOEntry(entryData)
+
+	return &entry
+}
+
+func (tx storeTx) PutUTXO(txID []byte, vout int, entry UTXOEntry) error {
+	return tx.put(utxoBucket, outpointKey(txID, vout), entry.Serialize())
+}
+
+func (tx storeTx) DeleteUTXO(txID []byte, vout int) error {
+	return tx.delete(utxoBucket, outpointKey(txID, vout))
+}
+
+func (tx storeTx) ForEachUTXO(fn func(txID []byte, vout int, entry UTXOEntry) error) error {
+	return tx.forEach(utxoBucket, func(k, v []byte) error {
+		txID, vout := parseOutpointKey(k)
+
+		return fn(txID, vout, DeserializeUTXOEntry(v))
+	})
+}
+
+func (tx storeTx) ClearUTXO() error {
+	return tx.clear(utxoBucket)
+}
+
+func (tx storeTx) GetUndo(hash []byte) *BlockUndo {
+	undoData := tx.get(undoBucket, hash)
+	if undoData == nil {
+		return nil
+	}
+
+	undo := DeserializeBlockUndo(undoData)
+
+	return &undo
+}
+
+func (tx storeTx) PutUndo(hash []byte, undo BlockUndo) error {
+	return tx.put(undoBucket, hash, undo.Serialize())
+}
+
+func (tx storeTx) DeleteUndo(hash []byte) error {
+	return tx.delete(undoBucket, hash)
+}
+
+func (tx storeTx) ClearUndo() error {
+	return tx.clear(undoBucket)
+}
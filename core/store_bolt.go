@@ -0,0 +1,104 @@
+package core
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+)
+
+// BoltStore 将区块链保存在Bolt数据库文件中，每个桶对应Bolt中的一个bucket
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore 打开（不存在时创建）Bolt数据库文件
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltStore{db}, nil
+}
+
+func (s *BoltStore) View(fn func(tx StoreTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(storeTx{boltTx{tx}})
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx StoreTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(storeTx{boltTx{tx}})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) get(bucket string, key []byte) []byte {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Get(key)
+}
+
+func (t boltTx) put(bucket string, key, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key, value)
+}
+
+func (t boltTx) delete(bucket string, key []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete(key)
+}
+
+func (t boltTx) forEach(bucket string, fn func(k, v []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.ForEach(fn)
+}
+
+func (t boltTx) forEachPrefix(bucket string, prefix []byte, fn func(k, v []byte) error) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t boltTx) clear(bucket string) error {
+	err := t.tx.DeleteBucket([]byte(bucket))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var errReadOnlyTx = errors.New("store: write in a read-only transaction")
+
+// MemoryStore 将区块链保存在内存中，进程退出后数据即丢失。
+// 用于单元测试和模拟，不需要在磁盘上创建数据库文件
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore 创建一个空的内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *MemoryStore) View(fn func(tx StoreTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(storeTx{&memoryTx{buckets: s.buckets}})
+}
+
+// 读写事务中被修改的桶会先复制一份，fn执行成功后才替换原来的桶
+func (s *MemoryStore) Update(fn func(tx StoreTx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{
+		buckets:  make(map[string]map[string][]byte, len(s.buckets)),
+		writable: true,
+		copied:   make(map[string]bool),
+	}
+	for name, bucket := range s.buckets {
+		tx.buckets[name] = bucket
+	}
+
+	err := fn(storeTx{tx})
+	if err != nil {
+		return err
+	}
+
+	s.buckets = tx.buckets
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+type memoryTx struct {
+	buckets  map[string]map[string][]byte
+	writable bool
+	copied   map[string]bool
+}
+
+// 返回可以修改的桶，第一次修改时复制原来的桶
+func (t *memoryTx) writableBucket(bucket string) (map[string][]byte, error) {
+	if !t.writable {
+		return nil, errReadOnlyTx
+	}
+
+	if !t.copied[bucket] {
+		b := make(map[string][]byte, len(t.buckets[bucket]))
+		for k, v := range t.buckets[bucket] {
+			b[k] = v
+		}
+		t.buckets[bucket] = b
+		t.copied[bucket] = true
+	}
+
+	return t.buckets[bucket], nil
+}
+
+func (t *memoryTx) get(bucket string, key []byte) []byte {
+	return t.buckets[bucket][string(key)]
+}
+
+func (t *memoryTx) put(bucket string, key, value []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	b[string(key)] = append([]byte{}, value...)
+
+	return nil
+}
+
+func (t *memoryTx) delete(bucket string, key []byte) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+	delete(b, string(key))
+
+	return nil
+}
+
+func (t *memoryTx) forEach(bucket string, fn func(k, v []byte) error) error {
+	b := t.buckets[bucket]
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := fn([]byte(k), b[k])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *memoryTx) forEachPrefix(bucket string, prefix []byte, fn func(k, v []byte) error) error {
+	return t.forEach(bucket, func(k, v []byte) error {
+		if !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+
+		return fn(k, v)
+	})
+}
+
+func (t *memoryTx) clear(bucket string) error {
+	if !t.writable {
+		return errReadOnlyTx
+	}
+
+	t.buckets[bucket] = make(map[string][]byte)
+	t.copied[bucket] = true
+
+	return nil
+}
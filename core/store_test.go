@@ -0,0 +1,268 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"blockchain/wallet"
+	"bytes"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 每种存储后端的构造函数，共用的测试对每一种都运行一遍
+func storeBackends() map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"bolt": func(t *testing.T) Store {
+			store, err := OpenBoltStore(filepath.Join(t.TempDir(), "blockchain.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { store.Close() })
+
+			return store
+		},
+	}
+}
+
+func mustUpdate(t *testing.T, store Store, fn func(tx StoreTx) error) {
+	t.Helper()
+
+	if err := store.Update(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreBlocks(t *testing.T) {
+	block := testBlock(t)
+
+	for name, newStore := range storeBackends() {
+		store := newStore(t)
+
+		mustUpdate(t, store, func(tx StoreTx) error {
+			if err := tx.PutBlock(block); err != nil {
+				return err
+			}
+			if err := tx.PutTip(block.Hash); err != nil {
+				return err
+			}
+
+			return tx.PutChainWork(block.Hash, big.NewInt(12345))
+		})
+		store.View(func(tx StoreTx) error {
+			if got := tx.GetBlock(block.Hash); got == nil || !bytes.Equal(got.Serialize(), block.Serialize()) || !bytes.Equal(got.Hash, block.Hash) || got.Height != block.Height {
+				t.Errorf("%s: GetBlock() = %+v, want %+v", name, got, block)
+			}
+			if got := tx.GetHeader(block.Hash); got == nil || !reflect.DeepEqual(*got, block.Header()) {
+				t.Errorf("%s: GetHeader() = %+v, want %+v", name, got, block.Header())
+			}
+			if got := tx.GetTip(); !bytes.Equal(got, block.Hash) {
+				t.Errorf("%s: GetTip() = %x, want %x", name, got, block.Hash)
+			}
+			if got := tx.GetChainWork(block.Hash); got.Cmp(big.NewInt(12345)) != 0 {
+				t.Errorf("%s: GetChainWork() = %s, want 12345", name, got)
+			}
+			if tx.GetBlock([]byte("missing")) != nil || tx.GetHeader([]byte("missing")) != nil {
+				t.Errorf("%s: found a block that was never stored", name)
+			}
+
+			return nil
+		})
+
+		// 删除区块时区块头一起删除
+		mustUpdate(t, store, func(tx StoreTx) error {
+			return tx.DeleteBlock(block.Hash)
+		})
+		store.View(func(tx StoreTx) error {
+			if tx.GetBlock(block.Hash) != nil || tx.GetHeader(block.Hash) != nil {
+				t.Errorf("%s: block or header is still stored after DeleteBlock", name)
+			}
+
+			return nil
+		})
+	}
+}
+
+func TestStoreHeightIndex(t *testing.T) {
+	for name, newStore := range storeBackends() {
+		store := newStore(t)
+
+		mustUpdate(t, store, func(tx StoreTx) error {
+			for height := 0; height < 300; height++ {
+				if err := tx.PutHashByHeight(height, []byte{byte(height), byte(height >> 8)}); err != nil {
+					return err
+				}
+			}
+
+			return tx.DeleteHashByHeight(299)
+		})
+		store.View(func(tx StoreTx) error {
+			for _, height := range []int{0, 1, 255, 256, 298} {
+				if got := tx.GetHashByHeight(height); !bytes.Equal(got, []byte{byte(height), byte(height >> 8)}) {
+					t.Errorf("%s: GetHashByHeight(%d) = %x", name, height, got)
+				}
+			}
+			if got := tx.GetHashByHeight(299); got != nil {
+				t.Errorf("%s: GetHashByHeight(299) after delete = %x", name, got)
+			}
+
+			return nil
+		})
+	}
+}
+
+func TestStoreUTXOAndUndo(t *testing.T) {
+	txID := bytes.Repeat([]byte{1}, 32)
+	entries := []UTXOEntry{
+		{*transaction.NewTXOutput(5, string(wallet.NewWallet().GetAddress())), 3, false},
+		{*transaction.NewTXOutput(7, string(wallet.NewWallet().GetAddress())), 4, true},
+		{*transaction.NewTXOutput(9, string(wallet.NewWallet().GetAddress())), 5, false},
+	}
+	undo := BlockUndo{[]SpentOutput{{txID, 1, entries[1]}, {bytes.Repeat([]byte{2}, 32), 0, entries[0]}}}
+	blockHash := []byte("block")
+
+	for name, newStore := range storeBackends() {
+		store := newStore(t)
+
+		// 乱序写入，遍历时按交易ID和输出序号排列
+		mustUpdate(t, store, func(tx StoreTx) error {
+			for _, vout := range []int{2, 0, 1} {
+				if err := tx.PutUTXO(txID, vout, entries[vout]); err != nil {
+					return err
+				}
+			}
+
+			return tx.PutUndo(blockHash, undo)
+		})
+		store.View(func(tx StoreTx) error {
+			if got := tx.GetUTXO(txID, 1); got == nil || !reflect.DeepEqual(*got, entries[1]) {
+				t.Errorf("%s: GetUTXO() = %+v, want %+v", name, got, entries[1])
+			}
+			var vouts []int
+			tx.ForEachUTXO(func(id []byte, vout int, entry UTXOEntry) error {
+				if !bytes.Equal(id, txID) || !reflect.DeepEqual(entry, entries[vout]) {
+					t.Errorf("%s: ForEachUTXO() visited %x:%d = %+v", name, id, vout, entry)
+				}
+				vouts = append(vouts, vout)
+
+				return nil
+			})
+			if !reflect.DeepEqual(vouts, []int{0, 1, 2}) {
+				t.Errorf("%s: ForEachUTXO() visited outputs %v, want [0 1 2]", name, vouts)
+			}
+			if got := tx.GetUndo(blockHash); got == nil || !reflect.DeepEqual(*got, undo) {
+				t.Errorf("%s: GetUndo() = %+v, want %+v", name, got, undo)
+			}
+
+			return nil
+		})
+
+		mustUpdate(t, store, func(tx StoreTx) error {
+			if err := tx.DeleteUTXO(txID, 1); err != nil {
+				return err
+			}
+
+			return tx.DeleteUndo(blockHash)
+		})
+		store.View(func(tx StoreTx) error {
+			if tx.GetUTXO(txID, 1) != nil || tx.GetUTXO(txID, 0) == nil {
+				t.Errorf("%s: DeleteUTXO removed the wrong outputs", name)
+			}
+			if tx.GetUndo(blockHash) != nil {
+				t.Errorf("%s: undo data is still stored after DeleteUndo", name)
+			}
+
+			return nil
+		})
+
+		mustUpdate(t, store, func(tx StoreTx) error {
+			return tx.ClearUTXO()
+		})
+		store.View(func(tx StoreTx) error {
+			tx.ForEachUTXO(func(id []byte, vout int, entry UTXOEntry) error {
+				t.Errorf("%s: ForEachUTXO() visited %x:%d after ClearUTXO", name, id, vout)
+				return nil
+			})
+
+			return nil
+		})
+	}
+}
+
+// Update中的函数返回错误时，事务中的修改全部丢弃
+func TestStoreUpdateRollsBackOnError(t *testing.T) {
+	failed := errors.New("failed")
+
+	for name, newStore := range storeBackends() {
+		store := newStore(t)
+
+		mustUpdate(t, store, func(tx StoreTx) error {
+			return tx.PutTip([]byte("old"))
+		})
+		err := store.Update(func(tx StoreTx) error {
+			tx.PutTip([]byte("new"))
+			tx.PutHashByHeight(1, []byte("new"))
+			if !bytes.Equal(tx.GetTip(), []byte("new")) {
+				t.Errorf("%s: a transaction does not see its own writes", name)
+			}
+
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("%s: Update() = %v, want the error returned by fn", name, err)
+		}
+		store.View(func(tx StoreTx) error {
+			if got := tx.GetTip(); !bytes.Equal(got, []byte("old")) {
+				t.Errorf("%s: GetTip() after a failed update = %s, want old", name, got)
+			}
+			if got := tx.GetHashByHeight(1); got != nil {
+				t.Errorf("%s: GetHashByHeight(1) after a failed update = %s", name, got)
+			}
+
+			return nil
+		})
+	}
+}
+
+func TestStoreFormatVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blockchain.db")
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(wallet.NewWallet().GetAddress())
+	bc := CreateBlockchainWithStore(address, store)
+	tip := bc.Tip
+	store.Close()
+
+	// 新创建的数据库带有当前的格式版本，重新打开后可以读取
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := checkStoreFormat(store); err != nil {
+		t.Fatalf("checkStoreFormat() = %v", err)
+	}
+	bc = NewBlockchainWithStore(store)
+	if _, err := bc.GetBlock(tip); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有格式标记（旧版本节点创建）或版本不同的数据库被拒绝
+	for _, version := range []int{0, storeFormatVersion + 1} {
+		store.Update(func(tx StoreTx) error {
+			if version == 0 {
+				return tx.(storeTx).delete(blocksBucket, []byte("format"))
+			}
+			return tx.PutFormatVersion(version)
+		})
+		if err := checkStoreFormat(store); !errors.Is(err, ErrIncompatibleStore) {
+			t.Fatalf("version %d: checkStoreFormat() = %v, want ErrIncompatibleStore", version, err)
+		}
+	}
+}
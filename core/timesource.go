@@ -0,0 +1,128 @@
+package core
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 计算过去中位时间使用的区块个数
+const medianTimeSpan = 11
+
+// 对方节点的时间与本机时间的差值超过这个范围时，不用它调整本机时间（秒）
+const maxTimeOffset = 70 * 60
+
+// 至少收到这么多个节点的时间后才调整本机时间，避免少数节点操纵时间
+const minTimeSamples = 5
+
+// 最多记录这么多个节点的时间，之后的节点不再记录
+const maxTimeSamples = 200
+
+// 区块时间戳最多可以超过节点调整后的时间多少秒
+var MaxFutureBlockTime int64 = 2 * 60 * 60
+
+// TimeSource 返回当前的Unix时间（秒）
+type TimeSource interface {
+	Now() int64
+}
+
+type systemTime struct{}
+
+func (systemTime) Now() int64 {
+	return time.Now().Unix()
+}
+
+// 本机时间
+var SystemTime TimeSource = systemTime{}
+
+// MedianTimeSource 用其他节点报告的时间调整本机时间：
+// 在本机时间上加上各节点时间与本机时间之差的中位数（包括本机自己的差值0），每个节点只记录一次
+type MedianTimeSource struct {
+	clock TimeSource
+
+	mu      sync.Mutex
+	offsets map[string]int64
+}
+
+func NewMedianTimeSource(clock TimeSource) *MedianTimeSource {
+	return &MedianTimeSource{clock: clock, offsets: make(map[string]int64)}
+}
+
+// AddSample records the time reported by a peer
+func (s *MedianTimeSource) AddSample(peer string, peerTime int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.offsets[peer]; ok || len(s.offsets) >= maxTimeSamples {
+		return
+	}
+	s.offsets[peer] = peerTime - s.clock.Now()
+}
+
+// Offset returns the median offset of the peers and the local clock,
+// or 0 if there are too few samples or the offset is out of range
+func (s *MedianTimeSource) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.offsets) < minTimeSamples {
+		return 0
+	}
+
+	offsets := []int64{0}
+	for _, offset := range s.offsets {
+		offsets = append(offsets, offset)
+	}
+	offset := median(offsets)
+
+	// 差值太大时，更可能是对方的时间错了，或者有人在操纵时间
+	if offset > maxTimeOffset || offset < -maxTimeOffset {
+		return 0
+	}
+
+	return offset
+}
+
+// Now returns the node-adjusted time
+func (s *MedianTimeSource) Now() int64 {
+	return s.clock.Now() + s.Offset()
+}
+
+// 节点调整后的时间，收到version消息时记录对方节点的时间，是Blockchain.Clock和Miner.Clock的默认值
+var AdjustedTime = NewMedianTimeSource(SystemTime)
+
+func median(values []int64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	return values[len(values)/2]
+}
+
+// 计算过去中位时间：block及其之前最多medianTimeSpan个区块的时间戳的中位数。
+// 新区块的时间戳必须大于父区块的过去中位时间
+func (bc *Blockchain) medianTimePast(block *Block) int64 {
+	timestamps := []int64{block.Timestamp}
+
+	prevHash := block.PrevBlockHash
+	for len(timestamps) < medianTimeSpan && len(prevHash) > 0 {
+		header, err := bc.GetHeader(prevHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		timestamps = append(timestamps, header.Timestamp)
+		prevHash = header.PrevBlockHash
+	}
+
+	return median(timestamps)
+}
+
+// 新区块的时间戳：节点调整后的时间，但至少比父区块的过去中位时间大1秒
+func (bc *Blockchain) nextTimestamp(parent *Block) int64 {
+	now := bc.Clock.Now()
+	minTime := bc.medianTimePast(parent) + 1
+	if now < minTime {
+		return minTime
+	}
+
+	return now
+}
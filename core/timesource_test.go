@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"blockchain/transaction"
+)
+
+// 测试中使用的固定时间
+type fakeClock struct {
+	now int64
+}
+
+func (c *fakeClock) Now() int64 {
+	return c.now
+}
+
+// 在主链末端加入一个指定时间戳的区块
+func addBlockAt(t *testing.T, bc *Blockchain, address string, timestamp int64) (*Block, error) {
+	t.Helper()
+
+	parent, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := transaction.NewCoinbaseTX(address, "", parent.Height+1, 0)
+	block := newUnminedBlock([]*transaction.Transaction{coinbase}, parent.Hash, parent.Height+1, bc.nextBits(&parent), timestamp)
+	if err := DefaultMiner.Mine(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block, bc.AddBlock(block)
+}
+
+func TestMedianTimePast(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: genesis.Timestamp + 1000}
+	bc.Clock = clock
+
+	// 时间戳不必递增，只要大于过去中位时间
+	offsets := []int64{100, 200, 300, 250, 260, 270, 280, 290, 310, 320, 330, 340}
+	for _, offset := range offsets {
+		if _, err := addBlockAt(t, bc, address, genesis.Timestamp+offset); err != nil {
+			t.Fatalf("AddBlock(+%d) = %v", offset, err)
+		}
+	}
+
+	// 最近11个区块的时间戳：200 300 250 260 270 280 290 310 320 330 340，中位数是290
+	tip, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bc.medianTimePast(&tip), genesis.Timestamp+290; got != want {
+		t.Fatalf("medianTimePast() = %d, want %d", got, want)
+	}
+
+	// 等于过去中位时间的时间戳被拒绝，大1秒的可以
+	if _, err := addBlockAt(t, bc, address, genesis.Timestamp+290); !errors.Is(err, ErrTimeTooOld) {
+		t.Fatalf("AddBlock(MTP) = %v, want %v", err, ErrTimeTooOld)
+	}
+	if _, err := addBlockAt(t, bc, address, genesis.Timestamp+291); err != nil {
+		t.Fatalf("AddBlock(MTP+1) = %v", err)
+	}
+}
+
+func TestNextTimestampIsAfterMedianTimePast(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: genesis.Timestamp + 1000}
+	bc.Clock = clock
+
+	tip, err := addBlockAt(t, bc, address, genesis.Timestamp+500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.nextTimestamp(tip); got != clock.now {
+		t.Fatalf("nextTimestamp() = %d, want the clock time %d", got, clock.now)
+	}
+
+	// 本机时间落后于过去中位时间时，使用过去中位时间加1秒
+	clock.now = genesis.Timestamp
+	want := bc.medianTimePast(tip) + 1
+	if got := bc.nextTimestamp(tip); got != want {
+		t.Fatalf("nextTimestamp() = %d, want %d", got, want)
+	}
+
+	block := mineTestBlock(t, bc, []*transaction.Transaction{transaction.NewCoinbaseTX(address, "", 2, 0)})
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock() = %v", err)
+	}
+}
+
+func TestFutureBlockTime(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	genesis, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{now: genesis.Timestamp + 1000}
+	bc.Clock = clock
+
+	maxTime := clock.now + MaxFutureBlockTime
+	if _, err := addBlockAt(t, bc, address, maxTime+1); !errors.Is(err, ErrTimeTooNew) {
+		t.Fatalf("AddBlock(max+1) = %v, want %v", err, ErrTimeTooNew)
+	}
+	if _, err := addBlockAt(t, bc, address, maxTime); err != nil {
+		t.Fatalf("AddBlock(max) = %v", err)
+	}
+
+	// 本机时间前进后，之前太新的时间戳变得有效
+	clock.now++
+	if _, err := addBlockAt(t, bc, address, maxTime+1); err != nil {
+		t.Fatalf("AddBlock(max+1) after the clock advanced = %v", err)
+	}
+}
+
+func TestMedianTimeSourceOffset(t *testing.T) {
+	clock := &fakeClock{now: 1000000}
+	s := NewMedianTimeSource(clock)
+
+	// 节点太少时不调整
+	for i, peerTime := range []int64{clock.now + 60, clock.now + 60, clock.now + 60, clock.now + 60} {
+		s.AddSample(string(rune('a'+i)), peerTime)
+	}
+	if got := s.Offset(); got != 0 {
+		t.Fatalf("Offset() with 4 samples = %d, want 0", got)
+	}
+
+	// 同一个节点只记录一次
+	s.AddSample("a", clock.now+600)
+	if got := s.Offset(); got != 0 {
+		t.Fatalf("Offset() after a repeated peer = %d, want 0", got)
+	}
+
+	// 5个节点加上本机的0：0 60 60 60 60 -30，中位数是60
+	s.AddSample("e", clock.now-30)
+	if got := s.Offset(); got != 60 {
+		t.Fatalf("Offset() = %d, want 60", got)
+	}
+	if got := s.Now(); got != clock.now+60 {
+		t.Fatalf("Now() = %d, want %d", got, clock.now+60)
+	}
+}
+
+func TestMedianTimeSourceIncludesLocalClock(t *testing.T) {
+	clock := &fakeClock{now: 1000000}
+	s := NewMedianTimeSource(clock)
+
+	// 节点的差值是 -20 -10 10 20 30，加上本机的0后中位数是10
+	for i, offset := range []int64{-20, -10, 10, 20, 30} {
+		s.AddSample(string(rune('a'+i)), clock.now+offset)
+	}
+	if got := s.Offset(); got != 10 {
+		t.Fatalf("Offset() = %d, want 10", got)
+	}
+}
+
+func TestMedianTimeSourceLimits(t *testing.T) {
+	clock := &fakeClock{now: 1000000}
+	s := NewMedianTimeSource(clock)
+
+	// 差值超过范围时不调整
+	for i := 0; i < minTimeSamples; i++ {
+		s.AddSample(string(rune('a'+i)), clock.now+maxTimeOffset+1)
+	}
+	if got := s.Offset(); got != 0 {
+		t.Fatalf("Offset() out of range = %d, want 0", got)
+	}
+
+	// 记录满之后的节点被忽略
+	s = NewMedianTimeSource(clock)
+	for i := 0; i < maxTimeSamples; i++ {
+		s.AddSample(fmt.Sprintf("peer-%d", i), clock.now)
+	}
+	for i := 0; i < maxTimeSamples; i++ {
+		s.AddSample(fmt.Sprintf("late-%d", i), clock.now+600)
+	}
+	if len(s.offsets) != maxTimeSamples {
+		t.Fatalf("stored %d samples, want %d", len(s.offsets), maxTimeSamples)
+	}
+	if got := s.Offset(); got != 0 {
+		t.Fatalf("Offset() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"blockchain/util"
+	"log"
+)
+
+const txIndexBucket = "txindex"
+
+// 交易索引中记录的交易位置：所在区块的哈希，以及交易在区块中的序号
+type TxLocation struct {
+	BlockHash []byte
+	Index     int
+}
+
+// Serialize serializes the transaction location: the block hash and the index
+func (loc TxLocation) Serialize() []byte {
+	var e util.Encoder
+
+	e.WriteBytes(loc.BlockHash)
+	e.WriteInt64(int64(loc.Index))
+
+	return e.Bytes()
+}
+
+// DeserializeTxLocation deserializes a transaction location
+func DeserializeTxLocation(data []byte) TxLocation {
+	var loc TxLocation
+	d := util.NewDecoder(data)
+
+	loc.BlockHash = d.ReadBytes()
+	loc.Index = int(d.ReadInt64())
+
+	err := d.Finish()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return loc
+}
+
+// 根据主链重建交易索引，并开启索引。此后连接、断开区块时会同步更新索引
+func (bc *Blockchain) ReindexTransactions() {
+	var blocks []*Block
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		blocks = append(blocks, block)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	err := bc.DB.Update(func(tx StoreTx) error {
+		err := tx.ClearTxIndex()
+		if err != nil {
+			log.Panic(err)
+		}
+
+		for _, block := range blocks {
+			indexTransactions(tx, block)
+		}
+
+		return tx.SetTxIndexEnabled(true)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// 关闭并删除交易索引，FindTransaction重新遍历区块查找交易
+func (bc *Blockchain) DisableTxIndex() {
+	err := bc.DB.Update(func(tx StoreTx) error {
+		err := tx.ClearTxIndex()
+		if err != nil {
+			log.Panic(err)
+		}
+
+		return tx.SetTxIndexEnabled(false)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// 将区块中的交易加入索引
+func indexTransactions(tx StoreTx, block *Block) {
+	for i, t := range block.Transactions {
+		err := tx.PutTxLocation(t.ID, TxLocation{block.Hash, i})
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// 将区块中的交易移出索引
+func unindexTransactions(tx StoreTx, block *Block) {
+	for _, t := range block.Transactions {
+		err := tx.DeleteTxLocation(t.ID)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+}
@@ -1,42 +1,166 @@
 package core
 
 import (
+	"bytes"
+	"encoding/binary"
 	"log"
-	"github.com/boltdb/bolt"
 	"blockchain/transaction"
+	"blockchain/util"
 	"encoding/hex"
+	"fmt"
 )
 
 const utxoBucket = "chainstate"
+const undoBucket = "undo"
+
+// coinbase交易的输出要经过CoinbaseMaturity次确认才能花费，
+// 避免挖出它的区块被切换掉后，花费它的交易随之失效
+var CoinbaseMaturity = 10
+
+// UTXOEntry 是UTXO集中的一个条目，对应一个未花费的输出（交易ID:输出序号）
+type UTXOEntry struct {
+	// 输出本身：金额和锁定的公钥哈希
+	Output transaction.TXOutput
+	// 创建该输出的区块高度
+	Height int
+	// 该输出是否由coinbase交易创建
+	IsCoinbase bool
+}
+
+// 输出能否在高度为height的区块中花费：普通输出总是可以，coinbase输出要有足够的确认数
+func (entry UTXOEntry) IsMature(height int) bool {
+	return !entry.IsCoinbase || height-entry.Height >= CoinbaseMaturity
+}
+
+// 编码后每个条目至少占用的字节数：输出的金额和脚本长度、高度、是否为coinbase
+const minUTXOEntrySize = 8 + 4 + 8 + 1
+
+// Encode 按规范二进制编码写入条目：输出、高度、是否为coinbase
+func (entry UTXOEntry) Encode(e *util.Encoder) {
+	entry.Output.Encode(e)
+	e.WriteInt64(int64(entry.Height))
+	e.WriteBool(entry.IsCoinbase)
+}
+
+// DecodeUTXOEntry 读取Encode写入的条目
+func DecodeUTXOEntry(d *util.Decoder) UTXOEntry {
+	var entry UTXOEntry
+
+	entry.Output = transaction.DecodeTXOutput(d)
+	entry.Height = int(d.ReadInt64())
+	entry.IsCoinbase = d.ReadBool()
+
+	return entry
+}
+
+// Serialize serializes UTXOEntry
+func (entry UTXOEntry) Serialize() []byte {
+	var e util.Encoder
+	entry.Encode(&e)
+
+	return e.Bytes()
+}
+
+// DeserializeUTXOEntry deserializes UTXOEntry
+func DeserializeUTXOEntry(data []byte) UTXOEntry {
+	d := util.NewDecoder(data)
+
+	entry := DecodeUTXOEntry(d)
+	err := d.Finish()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return entry
+}
+
+// UTXO集中条目的键：交易ID + 4字节大端序的输出序号，同一交易的输出在桶中相邻且按序号排列
+func outpointKey(txID []byte, vout int) []byte {
+	key := make([]byte, len(txID)+4)
+	copy(key, txID)
+	binary.BigEndian.PutUint32(key[len(txID):], uint32(vout))
+
+	return key
+}
+
+func parseOutpointKey(key []byte) ([]byte, int) {
+	txIDLen := len(key) - 4
+
+	return key[:txIDLen], int(binary.BigEndian.Uint32(key[txIDLen:]))
+}
+
+// BlockUndo 是区块的撤销数据：区块花费掉的所有输出在UTXO集中原来的条目，按花费的顺序排列
+type BlockUndo struct {
+	Spent []SpentOutput
+}
+
+// SpentOutput 记录一个被花费的输出和它原来的条目
+type SpentOutput struct {
+	TxID  []byte
+	Vout  int
+	Entry UTXOEntry
+}
+
+// Serialize serializes BlockUndo: the number of spent outputs, then each outpoint and its entry
+func (undo BlockUndo) Serialize() []byte {
+	var e util.Encoder
+
+	e.WriteUint32(uint32(len(undo.Spent)))
+	for _, spent := range undo.Spent {
+		e.WriteBytes(spent.TxID)
+		e.WriteInt64(int64(spent.Vout))
+		spent.Entry.Encode(&e)
+	}
+
+	return e.Bytes()
+}
+
+// DeserializeBlockUndo deserializes BlockUndo
+func DeserializeBlockUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+	d := util.NewDecoder(data)
+
+	count := d.ReadCount(4 + 8 + minUTXOEntrySize)
+	for i := 0; i < count; i++ {
+		var spent SpentOutput
+		spent.TxID = d.ReadBytes()
+		spent.Vout = int(d.ReadInt64())
+		spent.Entry = DecodeUTXOEntry(d)
+		undo.Spent = append(undo.Spent, spent)
+	}
+
+	err := d.Finish()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return undo
+}
 
 // UTXOSet represents UTXO set
 type UTXOSet struct {
 	Blockchain *Blockchain
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
+// FindSpendableOutputs finds and returns unspent outputs to reference in inputs.
+// Immature coinbase outputs are skipped
 func (u UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOutputs := make(map[string][]int)
 	accumulated := 0
 	db := u.Blockchain.DB
-
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			txID := hex.EncodeToString(k)
-			outs := transaction.DeserializeOutputs(v)
-
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				}
+	// 交易最早被打包进下一个区块
+	height := u.Blockchain.GetBestHeight() + 1
+
+	err := db.View(func(tx StoreTx) error {
+		return tx.ForEachUTXO(func(txID []byte, vout int, entry UTXOEntry) error {
+			if entry.Output.IsLockedWithKey(pubkeyHash) && entry.IsMature(height) && accumulated < amount {
+				key := hex.EncodeToString(txID)
+				accumulated += entry.Output.Value
+				unspentOutputs[key] = append(unspentOutputs[key], vout)
 			}
-		}
 
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
 		log.Panic(err)
@@ -50,19 +174,59 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []transaction.TXOutput {
 	var UTXOs []transaction.TXOutput
 	db := u.Blockchain.DB
 
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
+	err := db.View(func(tx StoreTx) error {
+		return tx.ForEachUTXO(func(txID []byte, vout int, entry UTXOEntry) error {
+			if entry.Output.IsLockedWithKey(pubKeyHash) {
+				UTXOs = append(UTXOs, entry.Output)
+			}
 
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			outs := transaction.DeserializeOutputs(v)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
 
-			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
-					UTXOs = append(UTXOs, out)
-				}
+	return UTXOs
+}
+
+// GetBalance returns the amount of coins locked with pubKeyHash that can be spent in the next block,
+// and the amount held in coinbase outputs that are not mature yet
+func (u UTXOSet) GetBalance(pubKeyHash []byte) (int, int) {
+	balance := 0
+	immature := 0
+	db := u.Blockchain.DB
+	height := u.Blockchain.GetBestHeight() + 1
+
+	err := db.View(func(tx StoreTx) error {
+		return tx.ForEachUTXO(func(txID []byte, vout int, entry UTXOEntry) error {
+			if !entry.Output.IsLockedWithKey(pubKeyHash) {
+				return nil
 			}
-		}
+
+			if entry.IsMature(height) {
+				balance += entry.Output.Value
+			} else {
+				immature += entry.Output.Value
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return balance, immature
+}
+
+// GetEntry returns the UTXO set entry of output vout of transaction txID, or nil if it is spent or unknown
+func (u UTXOSet) GetEntry(txID []byte, vout int) *UTXOEntry {
+	var entry *UTXOEntry
+	db := u.Blockchain.DB
+
+	err := db.View(func(tx StoreTx) error {
+		entry = tx.GetUTXO(txID, vout)
 
 		return nil
 	})
@@ -70,23 +234,30 @@ func (u UTXOSet) FindUTXO(pubKeyHash []byte) []transaction.TXOutput {
 		log.Panic(err)
 	}
 
-	return UTXOs
+	return entry
+}
+
+// IsUnspent checks whether output vout of transaction txID is still in the UTXO set
+func (u UTXOSet) IsUnspent(txID []byte, vout int) bool {
+	return u.GetEntry(txID, vout) != nil
 }
 
 // CountTransactions returns the number of transactions in the UTXO set
 func (u UTXOSet) CountTransactions() int {
 	db := u.Blockchain.DB
 	counter := 0
+	var lastTxID []byte
+
+	// 同一交易的输出在桶中相邻，交易ID变化时计数一次
+	err := db.View(func(tx StoreTx) error {
+		return tx.ForEachUTXO(func(txID []byte, vout int, entry UTXOEntry) error {
+			if lastTxID == nil || bytes.Compare(txID, lastTxID) != 0 {
+				counter++
+				lastTxID = append([]byte{}, txID...)
+			}
 
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
-
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			counter++
-		}
-
-		return nil
+			return nil
+		})
 	})
 	if err != nil {
 		log.Panic(err)
@@ -95,98 +266,125 @@ func (u UTXOSet) CountTransactions() int {
 	return counter
 }
 
-// Reindex rebuilds the UTXO set
+// Reindex rebuilds the UTXO set by applying the main chain block by block from the genesis block
 func (u UTXOSet) Reindex() {
 	db := u.Blockchain.DB
-	bucketName := []byte(utxoBucket)
+	bestHeight := u.Blockchain.GetBestHeight()
 
-	err := db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket(bucketName)
-		if err != nil && err != bolt.ErrBucketNotFound {
+	err := db.Update(func(tx StoreTx) error {
+		err := tx.ClearUTXO()
+		if err != nil {
 			log.Panic(err)
 		}
 
-		_, err = tx.CreateBucket(bucketName)
+		err = tx.ClearUndo()
 		if err != nil {
 			log.Panic(err)
 		}
 
+		for height := 0; height <= bestHeight; height++ {
+			block := tx.GetBlock(tx.GetHashByHeight(height))
+			err := u.update(tx, block)
+			if err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
 		log.Panic(err)
 	}
+}
+
 
-	UTXO := u.Blockchain.FindUTXO()
+// Update 将区块应用到UTXO集，同时保存区块的撤销数据
+func (u UTXOSet) Update(block *Block) {
+	err := u.Blockchain.DB.Update(func(tx StoreTx) error {
+		return u.update(tx, block)
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
+// Rollback 根据撤销数据将区块从UTXO集中撤销，区块必须是最后一个应用到UTXO集的区块
+func (u UTXOSet) Rollback(block *Block) {
+	err := u.Blockchain.DB.Update(func(tx StoreTx) error {
+		u.rollback(tx, block)
 
-		for txID, outs := range UTXO {
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				log.Panic(err)
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// 在存储事务中应用区块：逐个删除被花费的输出并记入撤销数据，再加入新的输出。
+// 每个输出有自己的条目，删除一个输出不会影响同一交易其他输出的序号。不能花费的输出（如数据输出）不加入UTXO集。
+// 被花费的输出不在UTXO集中时返回ErrMissingInput：跳过它会让撤销数据缺少这个输出，断开区块后UTXO集就不对了
+func (u UTXOSet) update(dbTx StoreTx, block *Block) error {
+	undo := BlockUndo{}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false {
+			for _, vin := range tx.Vin {
+				entry := dbTx.GetUTXO(vin.Txid, vin.Vout)
+				if entry == nil {
+					return fmt.Errorf("%w: %x:%d in block %x", ErrMissingInput, vin.Txid, vin.Vout, block.Hash)
+				}
+				undo.Spent = append(undo.Spent, SpentOutput{vin.Txid, vin.Vout, *entry})
+
+				err := dbTx.DeleteUTXO(vin.Txid, vin.Vout)
+				if err != nil {
+					log.Panic(err)
+				}
+			}
+		}
+
+		for outIdx, out := range tx.Vout {
+			if out.IsUnspendable() {
+				continue
 			}
 
-			err = b.Put(key, outs.Serialize())
+			err := dbTx.PutUTXO(tx.ID, outIdx, UTXOEntry{out, block.Height, tx.IsCoinbase()})
 			if err != nil {
 				log.Panic(err)
 			}
 		}
+	}
 
-		return nil
-	})
+	return dbTx.PutUndo(block.Hash, undo)
 }
 
+// 在存储事务中撤销区块：按花费的相反顺序恢复被花费的输出，再删除区块创建的输出。
+// 区块内花费的本区块输出也会先被恢复，随后一起删除
+func (u UTXOSet) rollback(dbTx StoreTx, block *Block) {
+	undo := dbTx.GetUndo(block.Hash)
+	if undo == nil {
+		log.Panicf("ERROR: No undo data for block %x", block.Hash)
+	}
 
-func (u UTXOSet) Update(block *Block) {
-	db := u.Blockchain.DB
-
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false {
-				for _, vin := range tx.Vin {
-					updatedOuts := transaction.TXOutputs{}
-					outsBytes := b.Get(vin.Txid)
-					outs := transaction.DeserializeOutputs(outsBytes)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.Txid)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						err := b.Put(vin.Txid, updatedOuts.Serialize())
-						if err != nil {
-							log.Panic(err)
-						}
-					}
-
-				}
-			}
+	for i := len(undo.Spent) - 1; i >= 0; i-- {
+		spent := undo.Spent[i]
 
-			newOutputs := transaction.TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
+		err := dbTx.PutUTXO(spent.TxID, spent.Vout, spent.Entry)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
 
-			err := b.Put(tx.ID, newOutputs.Serialize())
+	for _, tx := range block.Transactions {
+		for outIdx := range tx.Vout {
+			err := dbTx.DeleteUTXO(tx.ID, outIdx)
 			if err != nil {
 				log.Panic(err)
 			}
 		}
+	}
 
-		return nil
-	})
+	err := dbTx.DeleteUndo(block.Hash)
 	if err != nil {
 		log.Panic(err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// UTXO集的全部条目，键是输出的位置
+func utxoSnapshot(t *testing.T, bc *Blockchain) map[string]UTXOEntry {
+	t.Helper()
+
+	snapshot := make(map[string]UTXOEntry)
+	err := bc.DB.View(func(tx StoreTx) error {
+		return tx.ForEachUTXO(func(txID []byte, vout int, entry UTXOEntry) error {
+			snapshot[string(outpointKey(txID, vout))] = entry
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+func TestConnectDisconnectRestoresUTXOSet(t *testing.T) {
+	bc, w, address := newTestChain(t)
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 0
+
+	parent, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := utxoSnapshot(t, bc)
+
+	// spend花费创世区块的奖励，spendOwn花费同一区块中spend的第一个输出
+	u := UTXOSet{bc}
+	spend := NewUTXOTransaction(w, address, 3, 1, 0, nil, &u)
+	spendOwn := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: spend.ID, Vout: 0, Sequence: transaction.MaxSequence}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(2, address)},
+	}
+	spendOwn.ID = spendOwn.Hash()
+	spendOwn.Sign(w.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(spend.ID): *spend})
+
+	block := mineOn(t, bc, &parent, address, spend, spendOwn)
+	mustAddBlock(t, bc, block)
+
+	after := utxoSnapshot(t, bc)
+	for _, outpoint := range [][]byte{outpointKey(parent.Transactions[0].ID, 0), outpointKey(spend.ID, 0)} {
+		if _, ok := after[string(outpoint)]; ok {
+			t.Fatalf("spent output %x is still in the UTXO set", outpoint)
+		}
+	}
+	if entry, ok := after[string(outpointKey(spendOwn.ID, 0))]; !ok || entry.Height != block.Height || entry.Output.Value != 2 {
+		t.Fatalf("UTXO set entry of the in-block spend = %+v, %v", entry, ok)
+	}
+
+	bc.detachBlock(block)
+
+	if got := utxoSnapshot(t, bc); !reflect.DeepEqual(got, before) {
+		t.Fatalf("UTXO set after disconnect = %+v, want %+v", got, before)
+	}
+	bc.DB.View(func(tx StoreTx) error {
+		if tx.GetUndo(block.Hash) != nil {
+			t.Fatal("undo data of the disconnected block is still stored")
+		}
+		return nil
+	})
+}
+
+func TestUpdateRejectsMissingInput(t *testing.T) {
+	bc, _, address := newTestChain(t)
+	before := utxoSnapshot(t, bc)
+
+	missing := transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: []byte("missing"), Vout: 0, Sequence: transaction.MaxSequence}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(1, address)},
+	}
+	missing.ID = missing.Hash()
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+	block := &Block{Transactions: []*transaction.Transaction{coinbase, &missing}, Hash: []byte("block"), Height: 1}
+
+	u := UTXOSet{bc}
+	err := bc.DB.Update(func(tx StoreTx) error {
+		return u.update(tx, block)
+	})
+	if !errors.Is(err, ErrMissingInput) {
+		t.Fatalf("update() = %v, want ErrMissingInput", err)
+	}
+	if got := utxoSnapshot(t, bc); !reflect.DeepEqual(got, before) {
+		t.Fatal("a failed update changed the UTXO set")
+	}
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 区块验证失败时返回的错误，每条共识规则对应一种错误，可以用 errors.Is 判断
+var (
+	ErrInvalidProofOfWork  = errors.New("invalid proof of work")
+	ErrUnknownParent       = errors.New("parent block is unknown")
+	ErrBadHeight           = errors.New("block height is not parent height + 1")
+	ErrBadDifficulty       = errors.New("block difficulty does not match the expected target")
+	ErrNoTransactions      = errors.New("block has no transactions")
+	ErrNoCoinbase          = errors.New("first transaction is not a coinbase")
+	ErrMultipleCoinbase    = errors.New("block has more than one coinbase")
+	ErrBadCoinbaseValue    = errors.New("coinbase pays more than subsidy plus fees")
+	ErrBadTxID             = errors.New("transaction ID does not match its hash")
+	ErrMissingInput        = errors.New("input references an unknown output")
+	ErrDoubleSpend         = errors.New("input spends an already spent output")
+	ErrOutputsExceedInputs = errors.New("transaction outputs exceed its inputs")
+	ErrNegativeOutput      = errors.New("transaction output has a negative value")
+	ErrImmatureCoinbase    = errors.New("input spends an immature coinbase output")
+	ErrBadCoinbaseHeight   = errors.New("coinbase does not commit to the block height")
+	ErrDuplicateTx         = errors.New("transaction ID is already in the UTXO set")
+	ErrBadMerkleRoot       = errors.New("merkle root does not match the transactions")
+	ErrInvalidSignature    = errors.New("invalid transaction signature")
+	ErrTimeTooOld          = errors.New("block timestamp is not after the median time past")
+	ErrTimeTooNew          = errors.New("block timestamp is too far in the future")
+	ErrNonFinalTx          = errors.New("transaction lock time is not reached")
+	ErrSequenceLocked      = errors.New("transaction input relative lock time is not reached")
+	ErrBadDataOutput       = errors.New("transaction data output is malformed or too large")
+	ErrDataOutputValue     = errors.New("transaction data output carries a nonzero value")
+	ErrValueOutOfRange     = errors.New("value or sum of values exceeds the maximum amount")
+	ErrBlockTooLarge       = errors.New("block transactions exceed the maximum block size")
+	ErrNoInputs            = errors.New("transaction has no inputs")
+	ErrNoOutputs           = errors.New("transaction has no outputs")
+	ErrLooseCoinbase       = errors.New("coinbase transaction outside a block")
+	ErrInvalidBlock        = errors.New("block or one of its ancestors failed validation before")
+)
+
+// 验证区块是否满足共识规则。
+// 如果区块直接连接在当前主链末端，还会根据UTXO集检查交易输入；
+// 侧链上的区块在切换主链、连接到主链时再检查输入
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	err := bc.checkBlockHeader(block)
+	if err != nil {
+		return err
+	}
+
+	err = checkBlockTransactions(block)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Compare(block.PrevBlockHash, bc.Tip) == 0 {
+		return bc.checkBlockInputs(block)
+	}
+
+	return nil
+}
+
+// 检查工作量证明、与父区块的链接、区块高度、难度以及时间戳
+func (bc *Blockchain) checkBlockHeader(block *Block) error {
+	pow := NewProofOfWork(block)
+	if !pow.Validate() {
+		return fmt.Errorf("%w: block %x", ErrInvalidProofOfWork, block.Hash)
+	}
+
+	parent, err := bc.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("%w: block %x", ErrUnknownParent, block.Hash)
+	}
+
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("%w: block %x has height %d, parent has %d", ErrBadHeight, block.Hash, block.Height, parent.Height)
+	}
+
+	expectedBits := bc.nextBits(&parent)
+	if block.Bits != expectedBits {
+		return fmt.Errorf("%w: block %x has bits %08x, expected %08x", ErrBadDifficulty, block.Hash, block.Bits, expectedBits)
+	}
+
+	// 时间戳必须大于过去中位时间，且不能超过节点调整后的时间太多，否则难度调整可能被操纵
+	medianTime := bc.medianTimePast(&parent)
+	if block.Timestamp <= medianTime {
+		return fmt.Errorf("%w: block %x has timestamp %d, median time past is %d", ErrTimeTooOld, block.Hash, block.Timestamp, medianTime)
+	}
+
+	maxTime := bc.Clock.Now() + MaxFutureBlockTime
+	if block.Timestamp > maxTime {
+		return fmt.Errorf("%w: block %x has timestamp %d, max allowed is %d", ErrTimeTooNew, block.Hash, block.Timestamp, maxTime)
+	}
+
+	return nil
+}
+
+// 检查与链上状态无关的交易规则：区块头的Merkle树根与交易一致，第一笔交易是唯一的coinbase交易并记录了区块高度，
+// 交易不重复，交易ID与内容一致，交易有输入和输出，输出金额不为负数，数据输出格式正确，交易的总大小不超过MaxBlockSize
+func checkBlockTransactions(block *Block) error {
+	if len(block.Transactions) == 0 {
+		return fmt.Errorf("%w: block %x", ErrNoTransactions, block.Hash)
+	}
+
+	if !block.Transactions[0].IsCoinbase() {
+		return fmt.Errorf("%w: block %x", ErrNoCoinbase, block.Hash)
+	}
+
+	if bytes.Compare(block.MerkleRoot, block.HashTransactions()) != 0 {
+		return fmt.Errorf("%w: block %x", ErrBadMerkleRoot, block.Hash)
+	}
+
+	if block.Transactions[0].CoinbaseHeight() != block.Height {
+		return fmt.Errorf("%w: block %x", ErrBadCoinbaseHeight, block.Hash)
+	}
+
+	// Merkle树复制奇数层的最后一个节点，重复最后几笔交易的区块与原区块的Merkle树根相同，
+	// 因此区块中不能有重复的交易
+	seen := make(map[string]bool)
+	blockSize := 0
+
+	for i, tx := range block.Transactions {
+		blockSize += tx.Size()
+		if blockSize > MaxBlockSize {
+			return fmt.Errorf("%w: block %x", ErrBlockTooLarge, block.Hash)
+		}
+
+		if seen[string(tx.ID)] {
+			return fmt.Errorf("%w: transaction %x appears twice in block %x", ErrDuplicateTx, tx.ID, block.Hash)
+		}
+		seen[string(tx.ID)] = true
+
+		if i > 0 && tx.IsCoinbase() {
+			return fmt.Errorf("%w: block %x", ErrMultipleCoinbase, block.Hash)
+		}
+
+		if !txIDMatches(tx) {
+			return fmt.Errorf("%w: transaction %x", ErrBadTxID, tx.ID)
+		}
+
+		err := checkTxSanity(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 检查与链上状态无关的交易规则：交易至少有一个输入和一个输出（coinbase交易也有一个输入），
+// 输出金额不为负数，每个金额和金额之和都不超过transaction.MaxMoney，
+// 以OP_RETURN开头的输出是携带不超过script.MaxDataSize字节、金额为0的数据输出
+func checkTxSanity(tx *transaction.Transaction) error {
+	// 没有输入的交易不花费任何输出，可以凭空重复广播；没有输出的交易把全部输入作为手续费，也没有意义
+	if len(tx.Vin) == 0 {
+		return fmt.Errorf("%w: transaction %x", ErrNoInputs, tx.ID)
+	}
+	if len(tx.Vout) == 0 {
+		return fmt.Errorf("%w: transaction %x", ErrNoOutputs, tx.ID)
+	}
+
+	outputValue := 0
+
+	for _, out := range tx.Vout {
+		// 输出金额为负数时，输入减输出得到的手续费会被放大
+		if out.Value < 0 {
+			return fmt.Errorf("%w: transaction %x", ErrNegativeOutput, tx.ID)
+		}
+
+		var err error
+		outputValue, err = addMoney(outputValue, out.Value)
+		if err != nil {
+			return fmt.Errorf("%w: outputs of transaction %x", err, tx.ID)
+		}
+
+		if out.IsUnspendable() {
+			if _, ok := out.Data(); !ok {
+				return fmt.Errorf("%w: transaction %x", ErrBadDataOutput, tx.ID)
+			}
+			// 数据输出不能被花费，放在里面的币会永远丢失
+			if out.Value != 0 {
+				return fmt.Errorf("%w: transaction %x", ErrDataOutputValue, tx.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 交易ID是在签名之前计算的，验证时要去掉解锁脚本后再计算哈希。
+// coinbase交易的输入数据在计算交易ID时就已经存在，不能去掉
+func txIDMatches(tx *transaction.Transaction) bool {
+	if tx.IsCoinbase() {
+		return bytes.Compare(tx.ID, tx.Hash()) == 0
+	}
+
+	txCopy := tx.TrimmedCopy()
+
+	return bytes.Compare(tx.ID, txCopy.Hash()) == 0
+}
+
+// 累加金额。金额为负数、超过transaction.MaxMoney或者总和超过transaction.MaxMoney时返回错误，
+// 所有金额都不超过MaxMoney时总和不会发生整数溢出
+func addMoney(total, value int) (int, error) {
+	if value < 0 || value > transaction.MaxMoney || total > transaction.MaxMoney-value {
+		return 0, fmt.Errorf("%w: %d + %d", ErrValueOutOfRange, total, value)
+	}
+
+	return total + value, nil
+}
+
+// 根据UTXO集检查区块中每笔交易的输入：交易ID不与未花费的交易重复，引用的输出存在且未被花费，coinbase输出已经成熟，
+// 锁定时间和相对锁定时间已到，签名有效，输入金额不小于输出金额。
+// 区块中的交易可以花费同一区块中排在它前面的交易的输出。
+// 输入与输出的差额是交易的手续费，coinbase交易最多可以领取奖励金加上所有手续费
+func (bc *Blockchain) checkBlockInputs(block *Block) error {
+	UTXOSet := UTXOSet{bc}
+	spent := make(map[string]bool)
+	created := make(map[string]transaction.Transaction)
+	fees := 0
+
+	parent, err := bc.GetBlock(block.PrevBlockHash)
+	if err != nil {
+		return fmt.Errorf("%w: block %x", ErrUnknownParent, block.Hash)
+	}
+	medianTime := bc.medianTimePast(&parent)
+
+	for _, tx := range block.Transactions {
+		// 交易ID相同的交易还有未花费的输出时，新交易的输出会覆盖UTXO集中原来的条目
+		for outIdx := range tx.Vout {
+			if UTXOSet.IsUnspent(tx.ID, outIdx) {
+				return fmt.Errorf("%w: transaction %x", ErrDuplicateTx, tx.ID)
+			}
+		}
+
+		if tx.IsCoinbase() {
+			created[hex.EncodeToString(tx.ID)] = *tx
+			continue
+		}
+
+		prevTXs := make(map[string]transaction.Transaction)
+		inputValue := 0
+		// 每个输入引用的输出所在区块的高度，用于检查相对锁定时间
+		var inputHeights []int
+
+		for _, vin := range tx.Vin {
+			outpoint := fmt.Sprintf("%x:%d", vin.Txid, vin.Vout)
+			if spent[outpoint] {
+				return fmt.Errorf("%w: %s is spent twice in block %x", ErrDoubleSpend, outpoint, block.Hash)
+			}
+			spent[outpoint] = true
+
+			prevTxID := hex.EncodeToString(vin.Txid)
+			prevTx, inBlock := created[prevTxID]
+			if !inBlock {
+				var err error
+				prevTx, err = bc.FindTransaction(vin.Txid)
+				if err != nil {
+					return fmt.Errorf("%w: %s", ErrMissingInput, outpoint)
+				}
+			}
+
+			if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+				return fmt.Errorf("%w: %s", ErrMissingInput, outpoint)
+			}
+
+			if inBlock {
+				// 数据输出不会加入UTXO集，同一区块中的也不能花费
+				if prevTx.Vout[vin.Vout].IsUnspendable() {
+					return fmt.Errorf("%w: %s", ErrMissingInput, outpoint)
+				}
+				// 同一区块中的coinbase输出没有任何确认
+				if prevTx.IsCoinbase() {
+					return fmt.Errorf("%w: %s", ErrImmatureCoinbase, outpoint)
+				}
+				inputValue, err = addMoney(inputValue, prevTx.Vout[vin.Vout].Value)
+				if err != nil {
+					return fmt.Errorf("%w: inputs of transaction %x", err, tx.ID)
+				}
+				inputHeights = append(inputHeights, block.Height)
+			} else {
+				entry := UTXOSet.GetEntry(vin.Txid, vin.Vout)
+				if entry == nil {
+					return fmt.Errorf("%w: %s", ErrDoubleSpend, outpoint)
+				}
+				if !entry.IsMature(block.Height) {
+					return fmt.Errorf("%w: %s created at height %d", ErrImmatureCoinbase, outpoint, entry.Height)
+				}
+				inputValue, err = addMoney(inputValue, entry.Output.Value)
+				if err != nil {
+					return fmt.Errorf("%w: inputs of transaction %x", err, tx.ID)
+				}
+				inputHeights = append(inputHeights, entry.Height)
+			}
+
+			prevTXs[prevTxID] = prevTx
+		}
+
+		err := bc.checkTxLocks(tx, block.Height, medianTime, inputHeights)
+		if err != nil {
+			return err
+		}
+
+		outputValue := 0
+		for _, out := range tx.Vout {
+			outputValue, err = addMoney(outputValue, out.Value)
+			if err != nil {
+				return fmt.Errorf("%w: outputs of transaction %x", err, tx.ID)
+			}
+		}
+		if outputValue > inputValue {
+			return fmt.Errorf("%w: transaction %x spends %d, outputs %d", ErrOutputsExceedInputs, tx.ID, inputValue, outputValue)
+		}
+		fees, err = addMoney(fees, inputValue-outputValue)
+		if err != nil {
+			return fmt.Errorf("%w: fees of block %x", err, block.Hash)
+		}
+
+		if !tx.Verify(prevTXs) {
+			return fmt.Errorf("%w: transaction %x", ErrInvalidSignature, tx.ID)
+		}
+
+		created[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	reward := 0
+	for _, out := range block.Transactions[0].Vout {
+		reward, err = addMoney(reward, out.Value)
+		if err != nil {
+			return fmt.Errorf("%w: coinbase of block %x", err, block.Hash)
+		}
+	}
+	subsidy := transaction.BlockSubsidy(block.Height)
+	if reward > subsidy+fees {
+		return fmt.Errorf("%w: coinbase pays %d, subsidy %d and fees %d", ErrBadCoinbaseValue, reward, subsidy, fees)
+	}
+
+	return nil
+}
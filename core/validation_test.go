@@ -0,0 +1,301 @@
+package core
+
+import (
+	"blockchain/transaction"
+	"blockchain/wallet"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 降低难度，测试中每个区块只需要几百次哈希
+	TargetBits = 8
+
+	os.Exit(m.Run())
+}
+
+// 创建一个使用内存存储的区块链，创世区块的奖励发给返回的钱包
+func newTestChain(t *testing.T) (*Blockchain, *wallet.Wallet, string) {
+	t.Helper()
+
+	w := wallet.NewWallet()
+	address := fmt.Sprintf("%s", w.GetAddress())
+
+	return CreateBlockchainWithStore(address, NewMemoryStore()), w, address
+}
+
+// 在主链末端挖一个包含txs的区块，但不加入区块链
+func mineTestBlock(t *testing.T, bc *Blockchain, txs []*transaction.Transaction) *Block {
+	t.Helper()
+
+	parent, err := bc.GetBlock(bc.Tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := newUnminedBlock(txs, parent.Hash, parent.Height+1, bc.nextBits(&parent), bc.nextTimestamp(&parent))
+	if err := DefaultMiner.Mine(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+func TestCoinbaseValueOverflowIsRejected(t *testing.T) {
+	bc, _, address := newTestChain(t)
+
+	// 两个输出之和溢出为负数，不能绕过奖励金的检查
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+	coinbase.Vout = []transaction.TXOutput{*transaction.NewTXOutput(math.MaxInt64, address), *transaction.NewTXOutput(2, address)}
+	coinbase.ID = coinbase.Hash()
+
+	block := mineTestBlock(t, bc, []*transaction.Transaction{coinbase})
+	err := bc.AddBlock(block)
+	if !errors.Is(err, ErrValueOutOfRange) {
+		t.Fatalf("AddBlock() = %v, want %v", err, ErrValueOutOfRange)
+	}
+	if bc.GetBestHeight() != 0 {
+		t.Fatalf("best height = %d, want 0", bc.GetBestHeight())
+	}
+}
+
+func TestOutputSumAboveMaxMoneyIsRejected(t *testing.T) {
+	_, _, address := newTestChain(t)
+
+	tx := transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: []byte{1}, Vout: 0, Sequence: transaction.MaxSequence}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(transaction.MaxMoney, address), *transaction.NewTXOutput(1, address)},
+	}
+	if err := checkTxSanity(&tx); !errors.Is(err, ErrValueOutOfRange) {
+		t.Fatalf("checkTxSanity() = %v, want %v", err, ErrValueOutOfRange)
+	}
+
+	tx.Vout = tx.Vout[:1]
+	if err := checkTxSanity(&tx); err != nil {
+		t.Fatalf("checkTxSanity() = %v, want nil", err)
+	}
+}
+
+func TestBlockAboveMaxBlockSizeIsRejected(t *testing.T) {
+	bc, _, address := newTestChain(t)
+
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+	block := mineTestBlock(t, bc, []*transaction.Transaction{coinbase})
+
+	maxBlockSize := MaxBlockSize
+	MaxBlockSize = coinbase.Size() - 1
+	defer func() { MaxBlockSize = maxBlockSize }()
+
+	if err := bc.AddBlock(block); !errors.Is(err, ErrBlockTooLarge) {
+		t.Fatalf("AddBlock() = %v, want %v", err, ErrBlockTooLarge)
+	}
+
+	MaxBlockSize = coinbase.Size()
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatalf("AddBlock() = %v, want nil", err)
+	}
+}
+
+func TestTransactionWithoutInputsOrOutputsIsRejected(t *testing.T) {
+	bc, _, address := newTestChain(t)
+
+	noInputs := &transaction.Transaction{Vout: []transaction.TXOutput{*transaction.NewTXOutput(1, address)}}
+	noInputs.ID = noInputs.Hash()
+	if err := checkTxSanity(noInputs); !errors.Is(err, ErrNoInputs) {
+		t.Fatalf("checkTxSanity() = %v, want %v", err, ErrNoInputs)
+	}
+
+	noOutputs := &transaction.Transaction{Vin: []transaction.TXInput{{Txid: []byte{1}, Vout: 0, Sequence: transaction.MaxSequence}}}
+	noOutputs.ID = noOutputs.Hash()
+	if err := checkTxSanity(noOutputs); !errors.Is(err, ErrNoOutputs) {
+		t.Fatalf("checkTxSanity() = %v, want %v", err, ErrNoOutputs)
+	}
+
+	// 区块中的空交易同样被拒绝
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+	block := mineTestBlock(t, bc, []*transaction.Transaction{coinbase, noInputs})
+	if err := bc.AddBlock(block); !errors.Is(err, ErrNoInputs) {
+		t.Fatalf("AddBlock() = %v, want %v", err, ErrNoInputs)
+	}
+
+	coinbase.Vout = nil
+	coinbase.ID = coinbase.Hash()
+	block = mineTestBlock(t, bc, []*transaction.Transaction{coinbase})
+	if err := bc.AddBlock(block); !errors.Is(err, ErrNoOutputs) {
+		t.Fatalf("AddBlock() = %v, want %v", err, ErrNoOutputs)
+	}
+}
+
+func TestBlockSubsidySchedule(t *testing.T) {
+	defer func(subsidy, interval int) {
+		transaction.InitialSubsidy, transaction.HalvingInterval = subsidy, interval
+	}(transaction.InitialSubsidy, transaction.HalvingInterval)
+	transaction.InitialSubsidy, transaction.HalvingInterval = 10, 100
+
+	tests := []struct {
+		height  int
+		subsidy int
+		supply  int
+	}{
+		{0, 10, 10},
+		{99, 10, 1000},
+		{100, 5, 1005},
+		{199, 5, 1500},
+		{200, 2, 1502},
+		{300, 1, 1701},
+		{399, 1, 1800},
+		{400, 0, 1800},
+		{63 * 100, 0, 1800},
+		{-1, 0, 0},
+	}
+	for _, test := range tests {
+		if got := transaction.BlockSubsidy(test.height); got != test.subsidy {
+			t.Errorf("BlockSubsidy(%d) = %d, want %d", test.height, got, test.subsidy)
+		}
+		if got := transaction.TotalSupply(test.height); got != test.supply {
+			t.Errorf("TotalSupply(%d) = %d, want %d", test.height, got, test.supply)
+		}
+	}
+}
+
+// 没有手续费时，UTXO集中所有币的总和就是getsupply报告的发行量；奖励金超过减半后的数量的区块被拒绝
+func TestSupplyFollowsHalvings(t *testing.T) {
+	defer func(interval int) { transaction.HalvingInterval = interval }(transaction.HalvingInterval)
+	transaction.HalvingInterval = 2
+
+	bc, _, address := newTestChain(t)
+	extendChain(t, bc, address, 5)
+
+	total := 0
+	for _, entry := range utxoSnapshot(t, bc) {
+		total += entry.Output.Value
+	}
+	if want := transaction.TotalSupply(bc.GetBestHeight()); total != want {
+		t.Fatalf("UTXO set holds %d coins, TotalSupply() = %d", total, want)
+	}
+
+	tests := []struct {
+		reward int
+		want   error
+	}{
+		{transaction.BlockSubsidy(6) + 1, ErrBadCoinbaseValue},
+		{transaction.BlockSubsidy(5), ErrBadCoinbaseValue},
+		{transaction.BlockSubsidy(6), nil},
+	}
+	for _, test := range tests {
+		coinbase := transaction.NewCoinbaseTX(address, "", 6, 0)
+		coinbase.Vout[0].Value = test.reward
+		coinbase.ID = coinbase.Hash()
+		block := mineTestBlock(t, bc, []*transaction.Transaction{coinbase})
+		if err := bc.AddBlock(block); !errors.Is(err, test.want) {
+			t.Fatalf("AddBlock() with reward %d = %v, want %v", test.reward, err, test.want)
+		}
+	}
+}
+
+// 花费coinbase交易的第一个输出，付1个币的手续费
+func spendCoinbase(t *testing.T, w *wallet.Wallet, coinbase *transaction.Transaction, address string) *transaction.Transaction {
+	t.Helper()
+
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: coinbase.ID, Vout: 0, Sequence: transaction.MaxSequence}},
+		Vout: []transaction.TXOutput{*transaction.NewTXOutput(coinbase.Vout[0].Value-1, address)},
+	}
+	tx.ID = tx.Hash()
+	tx.Sign(w.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(coinbase.ID): *coinbase})
+
+	return tx
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	defer func(maturity int) { CoinbaseMaturity = maturity }(CoinbaseMaturity)
+	CoinbaseMaturity = 3
+
+	// 创世区块的coinbase输出在高度为height的区块中花费
+	tests := []struct {
+		height int
+		want   error
+	}{
+		{1, ErrImmatureCoinbase},
+		{2, ErrImmatureCoinbase},
+		{3, nil},
+		{4, nil},
+	}
+	for _, test := range tests {
+		bc, w, address := newTestChain(t)
+		chain := extendChain(t, bc, address, test.height-1)
+		spend := spendCoinbase(t, w, chain[0].Transactions[0], address)
+
+		// 交易池按下一个区块的高度检查
+		if _, err := bc.CheckMempoolTransaction(spend); !errors.Is(err, test.want) {
+			t.Errorf("height %d: CheckMempoolTransaction() = %v, want %v", test.height, err, test.want)
+		}
+		block := mineOn(t, bc, chain[len(chain)-1], address, spend)
+		if err := bc.AddBlock(block); !errors.Is(err, test.want) {
+			t.Errorf("height %d: AddBlock() = %v, want %v", test.height, err, test.want)
+		}
+	}
+
+	// 同一区块中的coinbase输出没有任何确认，即使不要求确认数也不能花费
+	CoinbaseMaturity = 0
+	bc, w, address := newTestChain(t)
+	coinbase := transaction.NewCoinbaseTX(address, "", 1, 0)
+	block := mineTestBlock(t, bc, []*transaction.Transaction{coinbase, spendCoinbase(t, w, coinbase, address)})
+	if err := bc.AddBlock(block); !errors.Is(err, ErrImmatureCoinbase) {
+		t.Fatalf("AddBlock() spending its own coinbase = %v, want %v", err, ErrImmatureCoinbase)
+	}
+}
+
+func TestCoinbaseHeightCommitment(t *testing.T) {
+	bc, _, address := newTestChain(t)
+
+	short := transaction.NewCoinbaseTX(address, "", 1, 0)
+	short.Vin[0].ScriptSig = short.Vin[0].ScriptSig[:3]
+	short.ID = short.Hash()
+
+	tests := []struct {
+		name     string
+		coinbase *transaction.Transaction
+		want     error
+	}{
+		{"commits to the parent height", transaction.NewCoinbaseTX(address, "", 0, 0), ErrBadCoinbaseHeight},
+		{"commits to a later height", transaction.NewCoinbaseTX(address, "", 2, 0), ErrBadCoinbaseHeight},
+		{"too short to hold the height", short, ErrBadCoinbaseHeight},
+		{"commits to the block height", transaction.NewCoinbaseTX(address, "", 1, 0), nil},
+	}
+	for _, test := range tests {
+		block := mineTestBlock(t, bc, []*transaction.Transaction{test.coinbase})
+		if err := bc.AddBlock(block); !errors.Is(err, test.want) {
+			t.Errorf("%s: AddBlock() = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestDuplicateTransactionsAreRejected(t *testing.T) {
+	bc, genesis, spend, address := newReorgTestChain(t)
+
+	tx := spend(3)
+	first := mineOn(t, bc, genesis, address, tx)
+	mustAddBlock(t, bc, first)
+	again := spend(2)
+
+	tests := []struct {
+		name string
+		txs  []*transaction.Transaction
+	}{
+		// 交易的输出还在UTXO集中，再次打包会覆盖原来的条目
+		{"already in the UTXO set", []*transaction.Transaction{tx}},
+		// 重复最后一笔交易的区块与原区块的Merkle树根相同
+		{"twice in one block", []*transaction.Transaction{again, again}},
+	}
+	for _, test := range tests {
+		block := mineOn(t, bc, first, address, test.txs...)
+		if err := bc.AddBlock(block); !errors.Is(err, ErrDuplicateTx) {
+			t.Errorf("%s: AddBlock() = %v, want %v", test.name, err, ErrDuplicateTx)
+		}
+	}
+}
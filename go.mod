@@ -3,7 +3,8 @@ module blockchain
 go 1.18
 
 require (
-	github.com/boltdb/bolt v1.3.1 // indirect
-	golang.org/x/crypto v0.5.0 // indirect
-	golang.org/x/sys v0.4.0 // indirect
+	github.com/boltdb/bolt v1.3.1
+	golang.org/x/crypto v0.5.0
 )
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,398 @@
+package script
+
+import (
+	"blockchain/util"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// 栈中最多的元素个数
+const MaxStackSize = 1000
+
+// 一个OP_CHECKMULTISIG最多检查的公钥个数
+const MaxPubKeysPerMultiSig = 20
+
+// 锁定时间和相对锁定时间最多占用的字节数
+const lockTimeNumLen = 5
+
+// 脚本执行失败时返回的错误
+var (
+	ErrScriptFailed          = errors.New("script: evaluated to false")
+	ErrVerifyFailed          = errors.New("script: verify failed")
+	ErrStackUnderflow        = errors.New("script: stack underflow")
+	ErrStackOverflow         = errors.New("script: stack size limit exceeded")
+	ErrScriptTooLong         = errors.New("script: script size limit exceeded")
+	ErrEarlyReturn           = errors.New("script: OP_RETURN executed")
+	ErrUnbalancedConditional = errors.New("script: unbalanced conditional")
+	ErrUnknownOpcode         = errors.New("script: unknown opcode")
+	ErrInvalidNumber         = errors.New("script: invalid number")
+	ErrNotPushOnly           = errors.New("script: signature script is not push only")
+	ErrInvalidPubKeyCount    = errors.New("script: invalid public key count")
+	ErrInvalidSignatureCount = errors.New("script: invalid signature count")
+	ErrNegativeLockTime      = errors.New("script: negative lock time")
+	ErrUnsatisfiedLockTime   = errors.New("script: lock time requirement not satisfied")
+	ErrUnsatisfiedSequence   = errors.New("script: sequence requirement not satisfied")
+)
+
+// Checker 提供脚本中与交易有关的检查，由交易实现
+type Checker interface {
+	// CheckSig 检查sig是否是pubKey对交易的有效签名。scriptCode是正在执行的锁定脚本，签名的内容包含它
+	CheckSig(sig, pubKey []byte, scriptCode Script) bool
+	// CheckLockTime 检查交易的锁定时间是否满足lockTime（OP_CHECKLOCKTIMEVERIFY）
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence 检查输入的相对锁定时间是否满足sequence（OP_CHECKSEQUENCEVERIFY）
+	CheckSequence(sequence int64) bool
+}
+
+// Execute 先执行解锁脚本，再在得到的栈上执行锁定脚本，栈顶为真时验证通过。
+// 锁定脚本是P2SH脚本时，还要执行解锁脚本中的赎回脚本
+func Execute(scriptSig, scriptPubKey Script, checker Checker) error {
+	if !scriptSig.IsPushOnly() {
+		return ErrNotPushOnly
+	}
+
+	stack, err := run(nil, scriptSig, checker)
+	if err != nil {
+		return err
+	}
+	// 执行锁定脚本之前的栈，P2SH输出用它执行赎回脚本
+	sigStack := append([][]byte{}, stack...)
+
+	stack, err = run(stack, scriptPubKey, checker)
+	if err != nil {
+		return err
+	}
+
+	if len(stack) == 0 || !asBool(stack[len(stack)-1]) {
+		return ErrScriptFailed
+	}
+
+	// P2SH：锁定脚本只检查了赎回脚本的哈希，还要用解锁脚本的其余数据执行赎回脚本
+	if _, ok := ExtractScriptHash(scriptPubKey); ok {
+		redeemScript := Script(sigStack[len(sigStack)-1])
+
+		stack, err = run(sigStack[:len(sigStack)-1], redeemScript, checker)
+		if err != nil {
+			return err
+		}
+
+		if len(stack) == 0 || !asBool(stack[len(stack)-1]) {
+			return ErrScriptFailed
+		}
+	}
+
+	return nil
+}
+
+// 字节串作为布尔值：全0（包括负0）为假，其他为真
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return !(i == len(data)-1 && b == 0x80)
+		}
+	}
+
+	return false
+}
+
+func fromBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+
+	return nil
+}
+
+type stack [][]byte
+
+func (s *stack) push(data []byte) {
+	*s = append(*s, data)
+}
+
+func (s *stack) pop() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	data := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+
+	return data, nil
+}
+
+func (s *stack) peek() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrStackUnderflow
+	}
+
+	return (*s)[len(*s)-1], nil
+}
+
+func (s *stack) popInt() (int64, error) {
+	data, err := s.pop()
+	if err != nil {
+		return 0, err
+	}
+
+	return decodeNum(data, 4)
+}
+
+// 在给定的栈上执行一个脚本，返回执行后的栈
+func run(initial [][]byte, script Script, checker Checker) ([][]byte, error) {
+	if len(script) > MaxScriptSize {
+		return nil, ErrScriptTooLong
+	}
+
+	instructions, err := Parse(script)
+	if err != nil {
+		return nil, err
+	}
+
+	st := stack(initial)
+	// 每层OP_IF的条件，所有条件都为真时才执行指令
+	var conditions []bool
+
+	for _, in := range instructions {
+		executing := true
+		for _, c := range conditions {
+			executing = executing && c
+		}
+
+		switch in.Op {
+		case OP_IF, OP_NOTIF:
+			condition := false
+			if executing {
+				data, err := st.pop()
+				if err != nil {
+					return nil, err
+				}
+				condition = asBool(data) == (in.Op == OP_IF)
+			}
+			conditions = append(conditions, condition)
+			continue
+		case OP_ELSE:
+			if len(conditions) == 0 {
+				return nil, ErrUnbalancedConditional
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OP_ENDIF:
+			if len(conditions) == 0 {
+				return nil, ErrUnbalancedConditional
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+
+		if !executing {
+			continue
+		}
+
+		err := step(&st, in, script, checker)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(st) > MaxStackSize {
+			return nil, ErrStackOverflow
+		}
+	}
+
+	if len(conditions) != 0 {
+		return nil, ErrUnbalancedConditional
+	}
+
+	return st, nil
+}
+
+// 执行一条不是条件分支的指令
+func step(st *stack, in Instruction, script Script, checker Checker) error {
+	switch {
+	case in.Op == OP_0:
+		st.push(nil)
+		return nil
+	case in.Op == OP_1NEGATE:
+		st.push(encodeNum(-1))
+		return nil
+	case in.Op >= OP_1 && in.Op <= OP_16:
+		st.push(encodeNum(int64(in.Op - OP_1 + 1)))
+		return nil
+	case in.isPush():
+		st.push(in.Data)
+		return nil
+	}
+
+	switch in.Op {
+	case OP_NOP:
+
+	case OP_VERIFY:
+		data, err := st.pop()
+		if err != nil {
+			return err
+		}
+		if !asBool(data) {
+			return ErrVerifyFailed
+		}
+
+	case OP_RETURN:
+		return ErrEarlyReturn
+
+	case OP_DROP:
+		_, err := st.pop()
+		if err != nil {
+			return err
+		}
+
+	case OP_DUP:
+		data, err := st.peek()
+		if err != nil {
+			return err
+		}
+		st.push(data)
+
+	case OP_SIZE:
+		data, err := st.peek()
+		if err != nil {
+			return err
+		}
+		st.push(encodeNum(int64(len(data))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := st.pop()
+		if err != nil {
+			return err
+		}
+		b, err := st.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if in.Op == OP_EQUALVERIFY {
+			if !equal {
+				return ErrVerifyFailed
+			}
+		} else {
+			st.push(fromBool(equal))
+		}
+
+	case OP_SHA256:
+		data, err := st.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(data)
+		st.push(hash[:])
+
+	case OP_HASH160:
+		data, err := st.pop()
+		if err != nil {
+			return err
+		}
+		st.push(util.Hash160(data))
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := st.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := st.pop()
+		if err != nil {
+			return err
+		}
+		valid := len(sig) > 0 && checker.CheckSig(sig, pubKey, script)
+		if in.Op == OP_CHECKSIGVERIFY {
+			if !valid {
+				return ErrVerifyFailed
+			}
+		} else {
+			st.push(fromBool(valid))
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		valid, err := checkMultiSig(st, script, checker)
+		if err != nil {
+			return err
+		}
+		if in.Op == OP_CHECKMULTISIGVERIFY {
+			if !valid {
+				return ErrVerifyFailed
+			}
+		} else {
+			st.push(fromBool(valid))
+		}
+
+	case OP_CHECKLOCKTIMEVERIFY, OP_CHECKSEQUENCEVERIFY:
+		// 只检查栈顶的值，不弹出，之后通常跟着OP_DROP
+		data, err := st.peek()
+		if err != nil {
+			return err
+		}
+		n, err := decodeNum(data, lockTimeNumLen)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return ErrNegativeLockTime
+		}
+		if in.Op == OP_CHECKLOCKTIMEVERIFY && !checker.CheckLockTime(n) {
+			return ErrUnsatisfiedLockTime
+		}
+		if in.Op == OP_CHECKSEQUENCEVERIFY && !checker.CheckSequence(n) {
+			return ErrUnsatisfiedSequence
+		}
+
+	default:
+		return fmt.Errorf("%w: 0x%02x", ErrUnknownOpcode, in.Op)
+	}
+
+	return nil
+}
+
+// m-of-n多重签名，栈上依次是：<签名1> ... <签名m> m <公钥1> ... <公钥n> n。
+// 签名的顺序必须与公钥的顺序一致，每个公钥最多匹配一个签名
+func checkMultiSig(st *stack, script Script, checker Checker) (bool, error) {
+	n, err := st.popInt()
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxPubKeysPerMultiSig {
+		return false, fmt.Errorf("%w: %d", ErrInvalidPubKeyCount, n)
+	}
+
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		pubKeys[i], err = st.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	m, err := st.popInt()
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, fmt.Errorf("%w: %d of %d", ErrInvalidSignatureCount, m, n)
+	}
+
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		sigs[i], err = st.pop()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	k := 0
+	for _, pubKey := range pubKeys {
+		if k == len(sigs) {
+			break
+		}
+		if len(sigs[k]) > 0 && checker.CheckSig(sigs[k], pubKey, script) {
+			k++
+		}
+	}
+
+	return k == len(sigs), nil
+}
@@ -0,0 +1,241 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Script 是锁定脚本（ScriptPubKey）或解锁脚本（ScriptSig）：一串操作码和压入栈的数据
+type Script []byte
+
+// 脚本的最大字节数
+const MaxScriptSize = 10000
+
+// ErrMalformedPush 表示压入数据的长度超出了脚本的末尾
+var ErrMalformedPush = errors.New("script: push data exceeds script length")
+
+// Instruction 是脚本中的一条指令。压入数据的指令Data为要压入的数据
+type Instruction struct {
+	Op   byte
+	Data []byte
+}
+
+// 是否是压入数据的指令（包括OP_0、OP_1NEGATE和OP_1到OP_16）
+func (in Instruction) isPush() bool {
+	return in.Op <= OP_16 && in.Op != 0x50
+}
+
+// Parse 把脚本拆分为指令
+func Parse(s Script) ([]Instruction, error) {
+	var instructions []Instruction
+
+	for i := 0; i < len(s); {
+		op := s[i]
+		i++
+
+		var n int
+		switch {
+		case op > OP_0 && op < OP_PUSHDATA1:
+			n = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, ErrMalformedPush
+			}
+			n = int(s[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		case op == OP_PUSHDATA4:
+			if i+4 > len(s) {
+				return nil, ErrMalformedPush
+			}
+			// 先与剩余长度比较再转换为int，避免长度在32位平台上溢出为负数
+			length := binary.LittleEndian.Uint32(s[i:])
+			i += 4
+			if uint64(length) > uint64(len(s)-i) {
+				return nil, ErrMalformedPush
+			}
+			n = int(length)
+		default:
+			instructions = append(instructions, Instruction{op, nil})
+			continue
+		}
+
+		if i+n > len(s) {
+			return nil, ErrMalformedPush
+		}
+		instructions = append(instructions, Instruction{op, s[i : i+n]})
+		i += n
+	}
+
+	return instructions, nil
+}
+
+// IsPushOnly 检查脚本是否只包含压入数据的指令。解锁脚本必须满足这一条件
+func (s Script) IsPushOnly() bool {
+	instructions, err := Parse(s)
+	if err != nil {
+		return false
+	}
+
+	for _, in := range instructions {
+		if !in.isPush() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsUnspendable 检查脚本是否以OP_RETURN开头，这样的锁定脚本无论解锁脚本是什么都会执行失败
+func (s Script) IsUnspendable() bool {
+	return len(s) > 0 && s[0] == OP_RETURN
+}
+
+// String 返回脚本的反汇编，例如 "OP_DUP OP_HASH160 <hex> OP_EQUALVERIFY OP_CHECKSIG"
+func (s Script) String() string {
+	instructions, err := Parse(s)
+	if err != nil {
+		return fmt.Sprintf("[invalid script %x]", []byte(s))
+	}
+
+	var parts []string
+	for _, in := range instructions {
+		switch {
+		case in.Data != nil:
+			parts = append(parts, hex.EncodeToString(in.Data))
+		case in.Op >= OP_1 && in.Op <= OP_16:
+			parts = append(parts, fmt.Sprintf("OP_%d", in.Op-OP_1+1))
+		case opcodeNames[in.Op] != "":
+			parts = append(parts, opcodeNames[in.Op])
+		default:
+			parts = append(parts, fmt.Sprintf("OP_UNKNOWN_%02x", in.Op))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Builder 按顺序拼接操作码和数据，构造脚本
+type Builder struct {
+	script Script
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp 添加一个操作码
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+
+	return b
+}
+
+// AddData 添加压入数据的指令，根据数据长度选择最短的编码
+func (b *Builder) AddData(data []byte) *Builder {
+	n := len(data)
+
+	switch {
+	case n == 0:
+		b.script = append(b.script, OP_0)
+	case n < OP_PUSHDATA1:
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(n))
+	case n <= 0xffff:
+		var length [2]byte
+		binary.LittleEndian.PutUint16(length[:], uint16(n))
+		b.script = append(b.script, OP_PUSHDATA2)
+		b.script = append(b.script, length[:]...)
+	default:
+		var length [4]byte
+		binary.LittleEndian.PutUint32(length[:], uint32(n))
+		b.script = append(b.script, OP_PUSHDATA4)
+		b.script = append(b.script, length[:]...)
+	}
+	b.script = append(b.script, data...)
+
+	return b
+}
+
+// AddInt 添加压入整数的指令，-1和0到16使用对应的操作码
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		return b.AddOp(OP_0)
+	case n == -1:
+		return b.AddOp(OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return b.AddOp(byte(OP_1 + n - 1))
+	}
+
+	return b.AddData(encodeNum(n))
+}
+
+func (b *Builder) Script() Script {
+	return b.script
+}
+
+// 脚本中的整数按小端序编码，最高字节的最高位是符号位，0编码为空字节串
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+
+	var result []byte
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+
+	// 最高字节的最高位已经被占用时，增加一个字节存放符号位
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// 解码整数，超过maxLen个字节时出错
+func decodeNum(data []byte, maxLen int) (int64, error) {
+	if len(data) > maxLen {
+		return 0, fmt.Errorf("%w: %d bytes", ErrInvalidNumber, len(data))
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << uint(8*i)
+	}
+
+	// 去掉符号位
+	last := data[len(data)-1]
+	if last&0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8*(len(data)-1)))
+		return -result, nil
+	}
+
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParsePushData(t *testing.T) {
+	data := bytes.Repeat([]byte{0xab}, 3)
+
+	tests := []struct {
+		name   string
+		script Script
+	}{
+		{"direct", Script{0x03, 0xab, 0xab, 0xab}},
+		{"OP_PUSHDATA1", Script{OP_PUSHDATA1, 0x03, 0xab, 0xab, 0xab}},
+		{"OP_PUSHDATA2", Script{OP_PUSHDATA2, 0x03, 0x00, 0xab, 0xab, 0xab}},
+		{"OP_PUSHDATA4", Script{OP_PUSHDATA4, 0x03, 0x00, 0x00, 0x00, 0xab, 0xab, 0xab}},
+	}
+
+	for _, test := range tests {
+		instructions, err := Parse(test.script)
+		if err != nil {
+			t.Fatalf("%s: Parse() = %v", test.name, err)
+		}
+		if len(instructions) != 1 || !bytes.Equal(instructions[0].Data, data) {
+			t.Fatalf("%s: Parse() = %v, want one push of %x", test.name, instructions, data)
+		}
+		if !test.script.IsPushOnly() {
+			t.Fatalf("%s: IsPushOnly() = false", test.name)
+		}
+	}
+}
+
+func TestParseMalformedPush(t *testing.T) {
+	scripts := []Script{
+		{0x03, 0xab, 0xab},
+		{OP_PUSHDATA1},
+		{OP_PUSHDATA1, 0x02, 0xab},
+		{OP_PUSHDATA2, 0x01},
+		{OP_PUSHDATA2, 0x02, 0x00, 0xab},
+		{OP_PUSHDATA4, 0x01, 0x00, 0x00},
+		{OP_PUSHDATA4, 0x02, 0x00, 0x00, 0x00, 0xab},
+		{OP_PUSHDATA4, 0xff, 0xff, 0xff, 0xff, 0xab},
+	}
+
+	for _, s := range scripts {
+		if _, err := Parse(s); !errors.Is(err, ErrMalformedPush) {
+			t.Fatalf("Parse(%x) = %v, want %v", []byte(s), err, ErrMalformedPush)
+		}
+		if s.IsPushOnly() {
+			t.Fatalf("IsPushOnly(%x) = true", []byte(s))
+		}
+	}
+}
+
+func TestBuilderAddData(t *testing.T) {
+	for _, n := range []int{0, 1, 75, 76, 255, 256, 0xffff, 0x10000} {
+		data := bytes.Repeat([]byte{0x01}, n)
+		s := NewBuilder().AddData(data).Script()
+
+		instructions, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(AddData(%d bytes)) = %v", n, err)
+		}
+		if len(instructions) != 1 {
+			t.Fatalf("AddData(%d bytes) parsed into %d instructions", n, len(instructions))
+		}
+		if n > 0 && !bytes.Equal(instructions[0].Data, data) {
+			t.Fatalf("AddData(%d bytes) round-trip mismatch", n)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package script
+
+import (
+	"blockchain/util"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 标准脚本模板
+
+// 公钥哈希的字节数
+const pubKeyHashLen = 20
+
+// PayToPubKeyHash 返回支付到公钥哈希（P2PKH）的锁定脚本：
+// OP_DUP OP_HASH160 <公钥哈希> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) Script {
+	return NewBuilder().
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).
+		Script()
+}
+
+// PayToPubKeyHashSig 返回花费P2PKH输出的解锁脚本：<签名> <公钥>
+func PayToPubKeyHashSig(sig, pubKey []byte) Script {
+	return NewBuilder().AddData(sig).AddData(pubKey).Script()
+}
+
+// ExtractPubKeyHash 返回P2PKH锁定脚本中的公钥哈希，不是P2PKH脚本时返回false
+func ExtractPubKeyHash(s Script) ([]byte, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) != 5 {
+		return nil, false
+	}
+
+	if instructions[0].Op != OP_DUP || instructions[1].Op != OP_HASH160 ||
+		len(instructions[2].Data) != pubKeyHashLen || instructions[2].Op != pubKeyHashLen ||
+		instructions[3].Op != OP_EQUALVERIFY || instructions[4].Op != OP_CHECKSIG {
+		return nil, false
+	}
+
+	return instructions[2].Data, true
+}
+
+// ExtractPubKeyHashSig 返回P2PKH解锁脚本中的签名和公钥，格式不符时返回false
+func ExtractPubKeyHashSig(s Script) ([]byte, []byte, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) != 2 || instructions[0].Data == nil || instructions[1].Data == nil {
+		return nil, nil, false
+	}
+
+	return instructions[0].Data, instructions[1].Data, true
+}
+
+// 地址的版本号，决定了发往这个地址的输出使用哪种锁定脚本
+const (
+	PubKeyHashAddrVersion = byte(0x00)
+	ScriptHashAddrVersion = byte(0x05)
+)
+
+// 地址中校验和的字节数
+const addressChecksumLen = 4
+
+// ErrUnsupportedAddress 表示地址的版本号未知或者长度不正确
+var ErrUnsupportedAddress = errors.New("script: unsupported address")
+
+// PayToAddress 根据Base58编码的地址（版本号 + 哈希 + 校验和）生成锁定脚本，地址的校验和由wallet.ValidateAddress检查
+func PayToAddress(address []byte) (Script, error) {
+	payload := util.Base58Decode(address)
+	if len(payload) != 1+pubKeyHashLen+addressChecksumLen {
+		return nil, ErrUnsupportedAddress
+	}
+	hash := payload[1 : len(payload)-addressChecksumLen]
+
+	switch payload[0] {
+	case PubKeyHashAddrVersion:
+		return PayToPubKeyHash(hash), nil
+	case ScriptHashAddrVersion:
+		return PayToScriptHash(hash), nil
+	}
+
+	return nil, fmt.Errorf("%w: version %d", ErrUnsupportedAddress, payload[0])
+}
+
+// ExtractAddressHash 返回锁定脚本对应的地址中的哈希：P2PKH脚本的公钥哈希或P2SH脚本的脚本哈希，其他脚本返回nil
+func ExtractAddressHash(s Script) []byte {
+	if hash, ok := ExtractPubKeyHash(s); ok {
+		return hash
+	}
+	if hash, ok := ExtractScriptHash(s); ok {
+		return hash
+	}
+
+	return nil
+}
+
+// PayToScriptHash 返回支付到脚本哈希（P2SH）的锁定脚本：OP_HASH160 <赎回脚本的哈希> OP_EQUAL。
+// 花费时解锁脚本的最后一项是赎回脚本，其余数据用于执行赎回脚本
+func PayToScriptHash(scriptHash []byte) Script {
+	return NewBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+}
+
+// ExtractScriptHash 返回P2SH锁定脚本中的脚本哈希，不是P2SH脚本时返回false
+func ExtractScriptHash(s Script) ([]byte, bool) {
+	if len(s) != 2+pubKeyHashLen+1 || s[0] != OP_HASH160 || s[1] != pubKeyHashLen || s[len(s)-1] != OP_EQUAL {
+		return nil, false
+	}
+
+	return s[2 : 2+pubKeyHashLen], true
+}
+
+// MultiSig 返回m-of-n多重签名脚本：OP_m <公钥1> ... <公钥n> OP_n OP_CHECKMULTISIG，通常作为P2SH的赎回脚本
+func MultiSig(m int, pubKeys [][]byte) (Script, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxPubKeysPerMultiSig {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPubKeyCount, len(pubKeys))
+	}
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("%w: %d of %d", ErrInvalidSignatureCount, m, len(pubKeys))
+	}
+
+	b := NewBuilder().AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	b.AddInt(int64(len(pubKeys))).AddOp(OP_CHECKMULTISIG)
+
+	return b.Script(), nil
+}
+
+// ExtractMultiSig 返回多重签名脚本需要的签名个数和所有公钥，不是多重签名脚本时返回false
+func ExtractMultiSig(s Script) (int, [][]byte, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) < 4 || instructions[len(instructions)-1].Op != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+
+	m, ok := smallInt(instructions[0])
+	if !ok {
+		return 0, nil, false
+	}
+	n, ok := smallInt(instructions[len(instructions)-2])
+	if !ok || n != len(instructions)-3 || m < 1 || m > n {
+		return 0, nil, false
+	}
+
+	var pubKeys [][]byte
+	for _, in := range instructions[1 : len(instructions)-2] {
+		if in.Data == nil {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, in.Data)
+	}
+
+	return m, pubKeys, true
+}
+
+// MultiSigSig 返回花费P2SH多重签名输出的解锁脚本：<签名1> ... <签名k> <赎回脚本>。
+// 签名按对应公钥在赎回脚本中的顺序排列
+func MultiSigSig(sigs [][]byte, redeemScript Script) Script {
+	b := NewBuilder()
+	for _, sig := range sigs {
+		b.AddData(sig)
+	}
+
+	return b.AddData(redeemScript).Script()
+}
+
+// ExtractMultiSigSig 返回P2SH多重签名解锁脚本中已有的签名和赎回脚本，格式不符时返回false
+func ExtractMultiSigSig(s Script) ([][]byte, Script, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) == 0 {
+		return nil, nil, false
+	}
+
+	var sigs [][]byte
+	for _, in := range instructions[:len(instructions)-1] {
+		if in.Data == nil {
+			return nil, nil, false
+		}
+		sigs = append(sigs, in.Data)
+	}
+
+	redeemScript := Script(instructions[len(instructions)-1].Data)
+	if _, _, ok := ExtractMultiSig(redeemScript); !ok {
+		return nil, nil, false
+	}
+
+	return sigs, redeemScript, true
+}
+
+// 压入小整数的指令的值
+func smallInt(in Instruction) (int, bool) {
+	switch {
+	case in.Op >= OP_1 && in.Op <= OP_16:
+		return int(in.Op-OP_1) + 1, true
+	case in.Data != nil:
+		n, err := decodeNum(in.Data, 4)
+		return int(n), err == nil
+	}
+
+	return 0, false
+}
+
+// HTLC的秘密的字节数
+const SecretSize = 32
+
+// HTLC 是哈希时间锁定合约的参数：收款人出示哈希为SecretHash的秘密即可领取，
+// 超过LockTime（区块高度或Unix时间，含义与交易的锁定时间相同）之后退款人可以取回
+type HTLC struct {
+	SecretHash    []byte
+	RecipientHash []byte
+	RefundHash    []byte
+	LockTime      uint32
+}
+
+// Script 返回合约的脚本，通常作为P2SH的赎回脚本：
+// OP_IF OP_SIZE 32 OP_EQUALVERIFY OP_SHA256 <秘密的哈希> OP_EQUALVERIFY OP_DUP OP_HASH160 <收款人公钥哈希>
+// OP_ELSE <超时时间> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <退款人公钥哈希>
+// OP_ENDIF OP_EQUALVERIFY OP_CHECKSIG
+func (h HTLC) Script() Script {
+	return NewBuilder().
+		AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt(SecretSize).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_SHA256).AddData(h.SecretHash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.RecipientHash).
+		AddOp(OP_ELSE).
+		AddInt(int64(h.LockTime)).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(h.RefundHash).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).
+		Script()
+}
+
+// ExtractHTLC 返回HTLC脚本的参数，不是HTLC脚本时返回false
+func ExtractHTLC(s Script) (HTLC, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) != 20 {
+		return HTLC{}, false
+	}
+
+	var lockTime int64
+	switch in := instructions[11]; {
+	case in.Op == OP_0:
+	case in.Op >= OP_1 && in.Op <= OP_16:
+		lockTime = int64(in.Op-OP_1) + 1
+	default:
+		lockTime, err = decodeNum(in.Data, lockTimeNumLen)
+		if err != nil {
+			return HTLC{}, false
+		}
+	}
+	if lockTime < 0 || lockTime > math.MaxUint32 {
+		return HTLC{}, false
+	}
+
+	h := HTLC{instructions[5].Data, instructions[9].Data, instructions[16].Data, uint32(lockTime)}
+	if len(h.SecretHash) != sha256.Size || len(h.RecipientHash) != pubKeyHashLen || len(h.RefundHash) != pubKeyHashLen {
+		return HTLC{}, false
+	}
+
+	// 其余的操作码用重新生成的脚本比较
+	if !bytes.Equal(h.Script(), s) {
+		return HTLC{}, false
+	}
+
+	return h, true
+}
+
+// HTLCRedeemSig 返回收款人用秘密花费P2SH HTLC输出的解锁脚本：<签名> <公钥> <秘密> OP_1 <赎回脚本>
+func HTLCRedeemSig(sig, pubKey, secret []byte, redeemScript Script) Script {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddData(secret).AddOp(OP_1).AddData(redeemScript).Script()
+}
+
+// HTLCRefundSig 返回退款人在超时后花费P2SH HTLC输出的解锁脚本：<签名> <公钥> OP_0 <赎回脚本>
+func HTLCRefundSig(sig, pubKey []byte, redeemScript Script) Script {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddOp(OP_0).AddData(redeemScript).Script()
+}
+
+// ExtractHTLCSecret 返回收款人领取HTLC输出的解锁脚本中公开的秘密，不是这种解锁脚本或秘密与哈希不符时返回false。
+// 原子交换的另一方用它在另一条链上领取对方锁定的币
+func ExtractHTLCSecret(scriptSig Script) ([]byte, bool) {
+	instructions, err := Parse(scriptSig)
+	if err != nil || len(instructions) != 5 || instructions[3].Op != OP_1 {
+		return nil, false
+	}
+
+	h, ok := ExtractHTLC(instructions[4].Data)
+	if !ok {
+		return nil, false
+	}
+
+	secret := instructions[2].Data
+	hash := sha256.Sum256(secret)
+	if !bytes.Equal(hash[:], h.SecretHash) {
+		return nil, false
+	}
+
+	return secret, true
+}
+
+// 数据输出最多携带的字节数
+const MaxDataSize = 80
+
+// ErrDataTooLarge 表示数据输出携带的数据超过了MaxDataSize
+var ErrDataTooLarge = errors.New("script: data output is too large")
+
+// NullData 返回携带数据的锁定脚本：OP_RETURN <数据>。执行到OP_RETURN时脚本直接失败，这种输出永远不能花费
+func NullData(data []byte) (Script, error) {
+	if len(data) > MaxDataSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrDataTooLarge, len(data))
+	}
+
+	return NewBuilder().AddOp(OP_RETURN).AddData(data).Script(), nil
+}
+
+// ExtractNullData 返回数据输出的锁定脚本中的数据，不是数据输出或数据超过MaxDataSize时返回false
+func ExtractNullData(s Script) ([]byte, bool) {
+	instructions, err := Parse(s)
+	if err != nil || len(instructions) != 2 || instructions[0].Op != OP_RETURN {
+		return nil, false
+	}
+
+	data := instructions[1].Data
+	nullData, err := NullData(data)
+	if err != nil || !bytes.Equal(nullData, s) {
+		return nil, false
+	}
+
+	return data, true
+}
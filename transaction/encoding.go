@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"blockchain/util"
+	"fmt"
+)
+
+// 交易的规范二进制编码（见util.Encoder）的版本号，编码格式改变时加1。
+// 交易ID、签名和Merkle树叶子都基于这个编码计算
+const TxEncodingVersion = 3
+
+// 编码后每个输入、输出至少占用的字节数，用于检查列表长度
+const (
+	minTXInputSize  = 4 + 8 + 4 + 4
+	minTXOutputSize = 8 + 4
+)
+
+// Encode 写入交易输入：交易ID、输出序号、解锁脚本、序列号
+func (in TXInput) Encode(e *util.Encoder) {
+	e.WriteBytes(in.Txid)
+	e.WriteInt64(int64(in.Vout))
+	e.WriteBytes(in.ScriptSig)
+	e.WriteUint32(in.Sequence)
+}
+
+// DecodeTXInput 读取Encode写入的交易输入
+func DecodeTXInput(d *util.Decoder) TXInput {
+	var in TXInput
+
+	in.Txid = d.ReadBytes()
+	in.Vout = int(d.ReadInt64())
+	in.ScriptSig = d.ReadBytes()
+	in.Sequence = d.ReadUint32()
+
+	return in
+}
+
+// Encode 写入交易输出：金额、锁定脚本
+func (out TXOutput) Encode(e *util.Encoder) {
+	e.WriteInt64(int64(out.Value))
+	e.WriteBytes(out.ScriptPubKey)
+}
+
+// DecodeTXOutput 读取Encode写入的交易输出
+func DecodeTXOutput(d *util.Decoder) TXOutput {
+	var out TXOutput
+
+	out.Value = int(d.ReadInt64())
+	out.ScriptPubKey = d.ReadBytes()
+
+	return out
+}
+
+// Encode 写入交易：版本号、交易ID、输入列表、输出列表、锁定时间
+func (tx Transaction) Encode(e *util.Encoder) {
+	e.WriteUint32(TxEncodingVersion)
+	e.WriteBytes(tx.ID)
+
+	e.WriteUint32(uint32(len(tx.Vin)))
+	for _, in := range tx.Vin {
+		in.Encode(e)
+	}
+
+	e.WriteUint32(uint32(len(tx.Vout)))
+	for _, out := range tx.Vout {
+		out.Encode(e)
+	}
+
+	e.WriteUint32(tx.LockTime)
+}
+
+// DecodeTransaction 读取Encode写入的交易，版本号不支持时出错
+func DecodeTransaction(d *util.Decoder) (Transaction, error) {
+	var tx Transaction
+
+	version := d.ReadUint32()
+	if d.Err() == nil && version != TxEncodingVersion {
+		return tx, fmt.Errorf("transaction: unsupported encoding version %d", version)
+	}
+	tx.ID = d.ReadBytes()
+
+	vinCount := d.ReadCount(minTXInputSize)
+	for i := 0; i < vinCount; i++ {
+		tx.Vin = append(tx.Vin, DecodeTXInput(d))
+	}
+
+	voutCount := d.ReadCount(minTXOutputSize)
+	for i := 0; i < voutCount; i++ {
+		tx.Vout = append(tx.Vout, DecodeTXOutput(d))
+	}
+
+	tx.LockTime = d.ReadUint32()
+
+	return tx, d.Err()
+}
+
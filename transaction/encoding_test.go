@@ -0,0 +1,89 @@
+package transaction
+
+import (
+	"blockchain/script"
+	"blockchain/util"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testTransaction() Transaction {
+	tx := Transaction{
+		Vin: []TXInput{
+			{Txid: bytes.Repeat([]byte{1}, 32), Vout: 0, ScriptSig: script.PayToPubKeyHashSig([]byte("sig"), []byte("pubkey")), Sequence: MaxSequence - 1},
+			{Txid: bytes.Repeat([]byte{2}, 32), Vout: 3, ScriptSig: nil, Sequence: SequenceFromBlocks(5)},
+		},
+		Vout: []TXOutput{
+			{Value: 7, ScriptPubKey: script.PayToPubKeyHash(bytes.Repeat([]byte{3}, 20))},
+			*NewDataTXOutput([]byte("document hash")),
+		},
+		LockTime: 123,
+	}
+	tx.ID = tx.Hash()
+
+	return tx
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	coinbase := Transaction{
+		Vin:  []TXInput{{Vout: -1, ScriptSig: []byte("coinbase data"), Sequence: MaxSequence}},
+		Vout: []TXOutput{{Value: BlockSubsidy(5), ScriptPubKey: script.PayToPubKeyHash(bytes.Repeat([]byte{4}, 20))}},
+	}
+	coinbase.ID = coinbase.Hash()
+
+	for _, tx := range []Transaction{testTransaction(), coinbase} {
+		got, err := ParseTransaction(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tx) {
+			t.Fatalf("decoded %+v, want %+v", got, tx)
+		}
+		if !bytes.Equal(got.Hash(), tx.ID) {
+			t.Fatal("transaction ID changed after round trip")
+		}
+	}
+}
+
+func TestDecodeTransactionTruncated(t *testing.T) {
+	data := testTransaction().Serialize()
+
+	for n := 0; n < len(data); n++ {
+		if _, err := ParseTransaction(data[:n]); !errors.Is(err, util.ErrShortData) {
+			t.Fatalf("%d of %d bytes: error = %v, want %v", n, len(data), err, util.ErrShortData)
+		}
+	}
+}
+
+func TestDecodeTransactionTrailingData(t *testing.T) {
+	data := append(testTransaction().Serialize(), 0)
+
+	if _, err := ParseTransaction(data); !errors.Is(err, util.ErrTrailingData) {
+		t.Fatalf("error = %v, want %v", err, util.ErrTrailingData)
+	}
+}
+
+func TestDecodeTransactionOversizedCount(t *testing.T) {
+	var e util.Encoder
+	e.WriteUint32(TxEncodingVersion)
+	e.WriteBytes([]byte{1})
+	// 输入个数远超剩余数据
+	e.WriteUint32(0xffffffff)
+	e.WriteUint32(0)
+	e.WriteUint32(0)
+
+	if _, err := ParseTransaction(e.Bytes()); !errors.Is(err, util.ErrShortData) {
+		t.Fatalf("error = %v, want %v", err, util.ErrShortData)
+	}
+}
+
+func TestDecodeTransactionUnsupportedVersion(t *testing.T) {
+	data := testTransaction().Serialize()
+	data[3]++
+
+	if _, err := ParseTransaction(data); err == nil {
+		t.Fatal("decoded a transaction with an unsupported version")
+	}
+}
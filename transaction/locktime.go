@@ -0,0 +1,57 @@
+package transaction
+
+// 锁定时间小于这个值时表示区块高度，否则表示Unix时间
+const LockTimeThreshold = 500000000
+
+// 输入序列号的默认值。所有输入都是这个值时，交易的锁定时间不起作用
+const MaxSequence = 0xffffffff
+
+// 输入序列号中相对锁定时间的编码，与比特币的BIP68相同
+const (
+	// 设置时序列号不表示相对锁定时间
+	SequenceLockTimeDisableFlag = 1 << 31
+	// 设置时相对锁定时间的单位是512秒，否则是区块个数
+	SequenceLockTimeTypeFlag = 1 << 22
+	// 相对锁定时间的值在低16位
+	SequenceLockTimeMask = 0x0000ffff
+	// 时间单位512秒 = 1 << 9
+	SequenceLockTimeGranularity = 9
+)
+
+// 交易是否可以打包进高度为height的区块。blockTime是这个区块的父区块的过去中位时间，
+// 使用过去中位时间而不是区块自己的时间戳，矿工就不能通过修改时间戳提前打包交易
+func (tx Transaction) IsFinal(height int, blockTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+
+	lockTime := int64(tx.LockTime)
+	if lockTime < LockTimeThreshold {
+		if lockTime < int64(height) {
+			return true
+		}
+	} else if lockTime < blockTime {
+		return true
+	}
+
+	// 所有输入都是MaxSequence时锁定时间不起作用
+	for _, vin := range tx.Vin {
+		if vin.Sequence != MaxSequence {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 根据区块个数生成相对锁定时间的序列号：引用的输出被确认blocks个区块之后才能花费
+func SequenceFromBlocks(blocks int) uint32 {
+	return uint32(blocks) & SequenceLockTimeMask
+}
+
+// 根据秒数生成相对锁定时间的序列号，按512秒向上取整
+func SequenceFromSeconds(seconds int64) uint32 {
+	units := (seconds + (1 << SequenceLockTimeGranularity) - 1) >> SequenceLockTimeGranularity
+
+	return SequenceLockTimeTypeFlag | (uint32(units) & SequenceLockTimeMask)
+}
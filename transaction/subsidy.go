@@ -0,0 +1,42 @@
+package transaction
+
+// 创世区块（高度为0）的奖励金
+var InitialSubsidy = 10
+
+// 每挖出HalvingInterval个区块，奖励金减半
+var HalvingInterval = 100
+
+// 任何一个金额以及一笔交易、一个区块中金额的总和都不能超过MaxMoney，验证时据此防止整数溢出。
+// 它应当大于所有区块的奖励金之和
+const MaxMoney = 21000000
+
+// 高度为height的区块的奖励金：InitialSubsidy每隔HalvingInterval个区块减半，减到0后不再发行
+func BlockSubsidy(height int) int {
+	halvings := height / HalvingInterval
+	if height < 0 || halvings >= 63 {
+		return 0
+	}
+
+	return InitialSubsidy >> uint(halvings)
+}
+
+// 高度0到height（含）的所有区块的奖励金之和，即到该高度为止发行的币的总量
+func TotalSupply(height int) int {
+	supply := 0
+
+	// 同一个减半周期内每个区块的奖励金相同，按周期累加
+	for start := 0; start <= height; start += HalvingInterval {
+		subsidy := BlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		end := start + HalvingInterval - 1
+		if end > height {
+			end = height
+		}
+		supply += subsidy * (end - start + 1)
+	}
+
+	return supply
+}
@@ -1,26 +1,33 @@
 package transaction
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"crypto/sha256"
-	"bytes"
-	"encoding/gob"
 	"log"
 	"crypto/ecdsa"
 	"encoding/hex"
 	"crypto/rand"
 	"crypto/elliptic"
 	"math/big"
+	"encoding/binary"
+	"blockchain/script"
+	"blockchain/util"
 )
 
-// 挖出新块的奖励金
-const subsidy = 10
+// coinbase交易输入的数据以区块高度（4字节）和额外随机数（8字节）开头，后面是任意数据，
+// 保证不同区块的coinbase交易ID不同
+const coinbaseHeightLen = 4
+const coinbaseExtraNonceLen = 8
 
-// 一个交易包含了交易ID、多个交易输入、多个交易输出
+// 一个交易包含了交易ID、多个交易输入、多个交易输出和锁定时间
 type Transaction struct {
 	ID []byte
 	Vin []TXInput
 	Vout []TXOutput
+	// 锁定时间：小于LockTimeThreshold时是区块高度，否则是Unix时间，交易只能打包进高度或时间超过它的区块，0表示不锁定
+	LockTime uint32
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -29,21 +36,53 @@ func (tx Transaction) IsCoinbase() bool {
 }
 
 // 当矿工挖出一个新的块时，它会向新的块中添加一个 coinbase 交易。
-// coinbase 交易只有一个输出，没有输入。
-func NewCoinbaseTX(to, data string) *Transaction {
+// coinbase 交易只有一个输出，没有输入。输出的金额是高度为height的区块的奖励金加上区块中交易的手续费fees。
+// 输入中记录区块高度和一个随机的额外随机数，矿工可以通过SetExtraNonce修改额外随机数
+func NewCoinbaseTX(to, data string, height, fees int) *Transaction {
 	if data == "" {
 		data = fmt.Sprintf("Reward to '%s'", to)
 	}
+
+	extraNonce := make([]byte, coinbaseExtraNonceLen)
+	_, err := rand.Read(extraNonce)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	coinbaseData := make([]byte, coinbaseHeightLen)
+	binary.BigEndian.PutUint32(coinbaseData, uint32(height))
+	coinbaseData = append(coinbaseData, extraNonce...)
+	coinbaseData = append(coinbaseData, []byte(data)...)
+
 	// 由于没有输入，所以 Txid 为空，Vout 等于 -1
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
+	txin := TXInput{[]byte{}, -1, coinbaseData, MaxSequence}
 	// 输出的 锁定脚本 暂时用地址to代替
-	txout := NewTXOutput(subsidy, to)
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
+	txout := NewTXOutput(BlockSubsidy(height)+fees, to)
+	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}, 0}
 	tx.ID = tx.Hash()
 
 	return &tx
 }
 
+// coinbase交易输入中记录的区块高度，数据格式不正确时返回-1
+func (tx Transaction) CoinbaseHeight() int {
+	if !tx.IsCoinbase() || len(tx.Vin[0].ScriptSig) < coinbaseHeightLen+coinbaseExtraNonceLen {
+		return -1
+	}
+
+	return int(binary.BigEndian.Uint32(tx.Vin[0].ScriptSig[:coinbaseHeightLen]))
+}
+
+// 修改coinbase交易的额外随机数并重新计算交易ID
+func (tx *Transaction) SetExtraNonce(extraNonce uint64) {
+	if tx.CoinbaseHeight() < 0 {
+		log.Panic("ERROR: Not a coinbase transaction")
+	}
+
+	binary.BigEndian.PutUint64(tx.Vin[0].ScriptSig[coinbaseHeightLen:], extraNonce)
+	tx.ID = tx.Hash()
+}
+
 // 交易哈希为交易ID
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
@@ -56,85 +95,246 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-func (tx Transaction) Serialize() []byte {
-	var encoded bytes.Buffer
+// 交易序列化后的字节数，用于计算手续费率和区块大小
+func (tx Transaction) Size() int {
+	return len(tx.Serialize())
+}
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
-	if err != nil {
-		log.Panic(err)
-	}
+// 交易的规范二进制编码，用于计算交易ID、存储和网络传输
+func (tx Transaction) Serialize() []byte {
+	var e util.Encoder
+	tx.Encode(&e)
 
-	return encoded.Bytes()
+	return e.Bytes()
 }
 
+// 对每个输入签名，只能花费P2PKH输出：解锁脚本为 <签名> <公钥>
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
 	if tx.IsCoinbase() {
 		return
 	}
-	// 复制交易副本
-	txCopy := tx.TrimmedCopy()
-	// 遍历交易副本的所有交易输入，对每个输入签名
-	for inID, vin := range txCopy.Vin {
+	pubKey := PubKeyBytes(privKey.PublicKey)
+
+	// 签名的内容不包括解锁脚本，先计算所有输入的签名哈希，再填入解锁脚本
+	signatures := make([][]byte, len(tx.Vin))
+	for inID, vin := range tx.Vin {
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
+		hash := tx.SignatureHash(inID, prevTx.Vout[vin.Vout].ScriptPubKey)
+		signatures[inID] = signHash(privKey, hash)
+	}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		if err != nil {
-			log.Panic(err)
+	for inID := range tx.Vin {
+		tx.Vin[inID].ScriptSig = script.PayToPubKeyHashSig(signatures[inID], pubKey)
+	}
+}
+
+// 用一个私钥为花费P2SH多重签名输出的第inID个输入添加签名，返回这个输入现在的签名个数。
+// 多个签名者可以依次调用，已有的签名会保留，并按公钥在赎回脚本中的顺序排列；签名个数达到要求后不再添加
+func (tx *Transaction) SignMultiSig(inID int, privKey ecdsa.PrivateKey, redeemScript script.Script) (int, error) {
+	m, pubKeys, ok := script.ExtractMultiSig(redeemScript)
+	if !ok {
+		return 0, errors.New("ERROR: Redeem script is not a multisig script")
+	}
+	pubKey := PubKeyBytes(privKey.PublicKey)
+	hash := tx.SignatureHash(inID, redeemScript)
+
+	// 已有的签名按公钥对应的位置放好
+	slots := make([][]byte, len(pubKeys))
+	sigs, _, _ := script.ExtractMultiSigSig(tx.Vin[inID].ScriptSig)
+	for _, sig := range sigs {
+		for i, key := range pubKeys {
+			if slots[i] == nil && verifySignature(key, hash, sig) {
+				slots[i] = sig
+				break
+			}
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
+	}
+
+	signed := false
+	for i, key := range pubKeys {
+		if bytes.Compare(key, pubKey) == 0 {
+			if slots[i] == nil {
+				slots[i] = signHash(privKey, hash)
+			}
+			signed = true
+		}
+	}
+	if !signed {
+		return 0, errors.New("ERROR: Key is not part of the multisig script")
+	}
+
+	var collected [][]byte
+	for _, sig := range slots {
+		if sig != nil && len(collected) < m {
+			collected = append(collected, sig)
+		}
+	}
+	tx.Vin[inID].ScriptSig = script.MultiSigSig(collected, redeemScript)
+
+	return len(collected), nil
+}
+
+// 为花费P2SH HTLC输出的所有输入签名。secret不为nil时由收款人用秘密领取，否则由退款人取回，
+// 取回时交易的锁定时间必须已经设为不小于合约的超时时间（签名覆盖锁定时间）
+func (tx *Transaction) SignHTLC(privKey ecdsa.PrivateKey, redeemScript script.Script, secret []byte) error {
+	h, ok := script.ExtractHTLC(redeemScript)
+	if !ok {
+		return errors.New("ERROR: Redeem script is not an HTLC script")
+	}
+	pubKey := PubKeyBytes(privKey.PublicKey)
+
+	keyHash := h.RefundHash
+	if secret != nil {
+		keyHash = h.RecipientHash
+	}
+	if bytes.Compare(util.Hash160(pubKey), keyHash) != 0 {
+		return errors.New("ERROR: Key cannot spend this branch of the HTLC script")
+	}
+	if secret == nil && tx.LockTime < h.LockTime {
+		return fmt.Errorf("ERROR: Refund transaction must be locked until %d", h.LockTime)
+	}
+
+	signatures := make([][]byte, len(tx.Vin))
+	for inID := range tx.Vin {
+		signatures[inID] = signHash(privKey, tx.SignatureHash(inID, redeemScript))
+	}
 
-		tx.Vin[inID].Signature = signature
+	for inID := range tx.Vin {
+		if secret != nil {
+			tx.Vin[inID].ScriptSig = script.HTLCRedeemSig(signatures[inID], pubKey, secret, redeemScript)
+		} else {
+			tx.Vin[inID].ScriptSig = script.HTLCRefundSig(signatures[inID], pubKey, redeemScript)
+		}
 	}
+
+	return nil
 }
 
+// 交易的副本，所有输入的解锁脚本都被去掉，签名覆盖其余的字段（包括锁定时间和输入的序列号）
 func (tx *Transaction) TrimmedCopy() Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, nil})
+		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, vin.Sequence})
 	}
 
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TXOutput{vout.Value, vout.PubKeyHash})
+		outputs = append(outputs, TXOutput{vout.Value, vout.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
-// 验证交易：对每个交易输入，取出签名中包含的r、s两个大数，通过公钥、待签名信息，验证签名的真实性
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+// 第inID个输入需要签名的哈希：在去掉解锁脚本的交易副本中，把这个输入的解锁脚本换成scriptCode（被花费输出的锁定脚本），
+// 然后计算哈希。签名因此同时绑定了交易的所有输入、输出和被花费的锁定脚本
+func (tx *Transaction) SignatureHash(inID int, scriptCode script.Script) []byte {
 	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	txCopy.Vin[inID].ScriptSig = scriptCode
+
+	return txCopy.Hash()
+}
+
+// 公钥由X、Y两个坐标组成，各按32字节写入。坐标开头为0时Bytes()会更短，直接拼接会让验证时从中间切分出错
+func PubKeyBytes(pub ecdsa.PublicKey) []byte {
+	pubKey := make([]byte, 64)
+	pub.X.FillBytes(pubKey[:32])
+	pub.Y.FillBytes(pubKey[32:])
+
+	return pubKey
+}
+
+// 签名由r、s两个大数组成，各按32字节写入
+func signHash(privKey ecdsa.PrivateKey, hash []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signature
+}
+
+// 取出签名中包含的r、s两个大数，通过公钥、待签名信息，验证签名的真实性
+func verifySignature(pubKey, hash, signature []byte) bool {
+	if len(signature) != 64 || len(pubKey) != 64 {
+		return false
+	}
+
+	r := big.Int{}
+	s := big.Int{}
+	r.SetBytes(signature[:32])
+	s.SetBytes(signature[32:])
+
+	x := big.Int{}
+	y := big.Int{}
+	x.SetBytes(pubKey[:32])
+	y.SetBytes(pubKey[32:])
+
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
+
+	return ecdsa.Verify(&rawPubKey, hash, &r, &s)
+}
+
+// 执行脚本时检查第inID个输入的签名
+type sigChecker struct {
+	tx   *Transaction
+	inID int
+}
+
+func (c sigChecker) CheckSig(sig, pubKey []byte, scriptCode script.Script) bool {
+	return verifySignature(pubKey, c.tx.SignatureHash(c.inID, scriptCode), sig)
+}
 
+// OP_CHECKLOCKTIMEVERIFY：交易的锁定时间与lockTime类型相同（都是高度或都是时间）且不小于lockTime，
+// 并且这个输入没有禁用锁定时间。共识规则保证交易在锁定时间之前不能打包，脚本因此也就在lockTime之前不能满足
+func (c sigChecker) CheckLockTime(lockTime int64) bool {
+	txLockTime := int64(c.tx.LockTime)
+	if (txLockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return false
+	}
+	if lockTime > txLockTime {
+		return false
+	}
+
+	return c.tx.Vin[c.inID].Sequence != MaxSequence
+}
+
+// OP_CHECKSEQUENCEVERIFY：输入的相对锁定时间与sequence类型相同且不小于sequence。
+// sequence设置了禁用标志时不做检查
+func (c sigChecker) CheckSequence(sequence int64) bool {
+	if sequence&SequenceLockTimeDisableFlag != 0 {
+		return true
+	}
+
+	txSequence := int64(c.tx.Vin[c.inID].Sequence)
+	if txSequence&SequenceLockTimeDisableFlag != 0 {
+		return false
+	}
+
+	const mask = SequenceLockTimeTypeFlag | SequenceLockTimeMask
+	if (txSequence&SequenceLockTimeTypeFlag) != (sequence&SequenceLockTimeTypeFlag) {
+		return false
+	}
+
+	return sequence&mask <= txSequence&mask
+}
+
+// 验证交易：对每个交易输入，先执行解锁脚本，再执行被花费输出的锁定脚本，脚本执行成功才能花费
+func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	for inID, vin := range tx.Vin {
 		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Vin[inID].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PubKey)
-		x.SetBytes(vin.PubKey[:(keyLen / 2)])
-		y.SetBytes(vin.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return false
+		}
+
+		err := script.Execute(vin.ScriptSig, prevTx.Vout[vin.Vout].ScriptPubKey, sigChecker{tx, inID})
+		if err != nil {
 			return false
 		}
 	}
@@ -142,14 +342,24 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	return true
 }
 
+// DeserializeTransaction deserializes a transaction read from the local store. It panics on malformed data
 func DeserializeTransaction(data []byte) Transaction {
-	var transaction Transaction
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
+	transaction, err := ParseTransaction(data)
 	if err != nil {
 		log.Panic(err)
 	}
 
 	return transaction
+}
+
+// ParseTransaction deserializes a transaction received from a peer or a user, returning an error on malformed data
+func ParseTransaction(data []byte) (Transaction, error) {
+	d := util.NewDecoder(data)
+
+	transaction, err := DecodeTransaction(d)
+	if err != nil {
+		return transaction, err
+	}
+
+	return transaction, d.Finish()
 }
\ No newline at end of file
@@ -1,8 +1,7 @@
 package transaction
 
 import (
-	"bytes"
-	"blockchain/wallet"
+	"blockchain/script"
 )
 
 // 交易输入（一个输入引用了之前交易的一个输出）
@@ -11,14 +10,11 @@ type TXInput struct {
 	Txid []byte
 	// 之前交易输出的某一个索引（一个交易可以有多个输出，我们需要指出具体是哪一个）
 	Vout int
-	// 输入数字签名和公钥
-	Signature []byte
-	PubKey []byte
+	// 解锁脚本，提供满足被引用输出的锁定脚本的数据，例如签名和公钥。
+	// coinbase交易的输入没有引用输出，这里记录区块高度等数据
+	ScriptSig script.Script
+	// 序列号：没有设置SequenceLockTimeDisableFlag时是相对锁定时间，见SequenceLock。
+	// 所有输入都是MaxSequence时交易的LockTime不起作用
+	Sequence uint32
 }
 
-// 检查输出的公钥哈希pubKeyHash是否是由输入的公钥生成的
-func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
-	lockingHash := wallet.HashPubKey(in.PubKey)
-
-	return bytes.Compare(lockingHash, pubKeyHash) == 0
-}
\ No newline at end of file
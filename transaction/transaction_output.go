@@ -1,35 +1,39 @@
 package transaction
 
 import (
-	"blockchain/util"
+	"blockchain/script"
 	"bytes"
 	"log"
-	"encoding/gob"
 )
 
 // 交易输出
 type TXOutput struct {
 	// 一定数量的币
 	Value int
-	// 输出公钥哈希
-	PubKeyHash []byte
+	// 锁定脚本，规定花费这个输出需要满足的条件
+	ScriptPubKey script.Script
 }
 
-type TXOutputs struct {
-	Outputs []TXOutput
-}
-
-// 对于一笔发往address的交易，需要对该地址进行锁定（即计算该地址对应的公钥哈希，存入交易输出中）
+// 对于一笔发往address的交易，需要对该地址进行锁定（即根据地址的版本号，用地址中的公钥哈希或脚本哈希生成锁定脚本，存入交易输出中）
 // ，从而对这笔交易进行唯一性标记
 func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := util.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	out.PubKeyHash = pubKeyHash
+	scriptPubKey, err := script.PayToAddress(address)
+	if err != nil {
+		log.Panic(err)
+	}
+	out.ScriptPubKey = scriptPubKey
+}
+
+// 输出所属地址中的哈希：P2PKH输出的公钥哈希或P2SH输出的脚本哈希，其他类型的输出返回nil
+func (out *TXOutput) AddressHash() []byte {
+	return script.ExtractAddressHash(out.ScriptPubKey)
 }
 
-// 通过对比接收方的公钥哈希与接收到的交易输出中的公钥哈希是否一致，可以验证该笔交易的目的地址是否正确
+// 通过对比接收方地址中的哈希（公钥哈希或脚本哈希）与接收到的交易输出中的哈希是否一致，可以验证该笔交易的目的地址是否正确
 func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Compare(out.PubKeyHash, pubKeyHash) == 0
+	lockingHash := out.AddressHash()
+
+	return lockingHash != nil && bytes.Compare(lockingHash, pubKeyHash) == 0
 }
 
 // NewTXOutput create a new TXOutput
@@ -40,28 +44,23 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
-// Serialize serializes TXOutputs
-func (outs TXOutputs) Serialize() []byte {
-	var buff bytes.Buffer
-
-	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(outs)
+// NewDataTXOutput creates an unspendable TXOutput carrying data
+// 携带数据的输出：金额为0，锁定脚本为 OP_RETURN <数据>，不能花费，也不会加入UTXO集
+func NewDataTXOutput(data []byte) *TXOutput {
+	scriptPubKey, err := script.NullData(data)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return buff.Bytes()
+	return &TXOutput{0, scriptPubKey}
 }
 
-// DeserializeOutputs deserializes TXOutputs
-func DeserializeOutputs(data []byte) TXOutputs {
-	var outputs TXOutputs
-
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&outputs)
-	if err != nil {
-		log.Panic(err)
-	}
+// 输出是否永远不能花费，例如携带数据的输出
+func (out *TXOutput) IsUnspendable() bool {
+	return out.ScriptPubKey.IsUnspendable()
+}
 
-	return outputs
-}
\ No newline at end of file
+// 数据输出携带的数据，不是数据输出时返回false
+func (out *TXOutput) Data() ([]byte, bool) {
+	return script.ExtractNullData(out.ScriptPubKey)
+}
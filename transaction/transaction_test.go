@@ -0,0 +1,33 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+)
+
+// X坐标开头为0的公钥，拼接时如果不补齐会只有63字节
+func TestSignatureWithShortCoordinate(t *testing.T) {
+	var privKey *ecdsa.PrivateKey
+	for privKey == nil || privKey.PublicKey.X.BitLen() > 248 {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privKey = key
+	}
+
+	pubKey := PubKeyBytes(privKey.PublicKey)
+	if len(pubKey) != 64 {
+		t.Fatalf("public key is %d bytes, want 64", len(pubKey))
+	}
+	hash := sha256.Sum256([]byte("message"))
+	if !verifySignature(pubKey, hash[:], signHash(*privKey, hash[:])) {
+		t.Fatal("valid signature rejected")
+	}
+	if verifySignature(pubKey[1:], hash[:], signHash(*privKey, hash[:])) {
+		t.Fatal("truncated public key accepted")
+	}
+}
@@ -7,7 +7,9 @@ import (
 
 var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
 
-// Base58Encode encodes a byte array to Base58
+// Base58Encode encodes a byte array to Base58.
+// 前导的0字节在大整数中会丢失，因此每个前导0字节单独编码为一个'1'，
+// 不以0字节开头的输入（例如版本号0x05的P2SH地址）前面不加'1'
 func Base58Encode(input []byte) []byte {
 	var result []byte
 
@@ -23,7 +25,8 @@ func Base58Encode(input []byte) []byte {
 	}
 
 	ReverseBytes(result)
-	for b := range input {
+	// 每个前导的0字节编码为一个'1'
+	for _, b := range input {
 		if b == 0x00 {
 			result = append([]byte{b58Alphabet[0]}, result...)
 		} else {
@@ -34,14 +37,16 @@ func Base58Encode(input []byte) []byte {
 	return result
 }
 
-// Base58Decode decodes Base58-encoded data
+// Base58Decode decodes Base58-encoded data. 每个前导的'1'解码为一个0字节，与Base58Encode对应
 func Base58Decode(input []byte) []byte {
 	result := big.NewInt(0)
 	zeroBytes := 0
 
-	for b := range input {
-		if b == 0x00 {
+	for _, b := range input {
+		if b == b58Alphabet[0] {
 			zeroBytes++
+		} else {
+			break
 		}
 	}
 
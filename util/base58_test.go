@@ -0,0 +1,66 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBase58RoundTrip(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 20)
+	checksum := []byte{0x01, 0x02, 0x03, 0x04}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", []byte{}},
+		{"version 0x00", append(append([]byte{0x00}, hash...), checksum...)},
+		{"version 0x05", append(append([]byte{0x05}, hash...), checksum...)},
+		{"leading zeros", []byte{0x00, 0x00, 0x00, 0x01, 0x02}},
+		{"only zeros", []byte{0x00, 0x00}},
+		{"zero inside", []byte{0x05, 0x00, 0x00, 0x01}},
+	}
+
+	for _, test := range tests {
+		encoded := Base58Encode(test.input)
+		decoded := Base58Decode(encoded)
+		if !bytes.Equal(decoded, test.input) {
+			t.Fatalf("%s: Base58Decode(%s) = %x, want %x", test.name, encoded, decoded, test.input)
+		}
+	}
+}
+
+func TestBase58AddressPrefix(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 20)
+
+	// 版本号0x00的地址以'1'开头，版本号0x05的地址以'3'开头
+	p2pkh := Base58Encode(append([]byte{0x00}, append(hash, 0, 0, 0, 0)...))
+	if p2pkh[0] != '1' || p2pkh[1] == '1' {
+		t.Fatalf("version 0x00 address = %s, want a single leading '1'", p2pkh)
+	}
+
+	p2sh := Base58Encode(append([]byte{0x05}, append(hash, 0, 0, 0, 0)...))
+	if p2sh[0] != '3' {
+		t.Fatalf("version 0x05 address = %s, want a leading '3'", p2sh)
+	}
+}
+
+func TestBase58Vectors(t *testing.T) {
+	tests := []struct {
+		input   []byte
+		encoded string
+	}{
+		{[]byte("hello world"), "StV1DL6CwTryKyV"},
+		{[]byte{0x00, 0x00, 0x28, 0x7f, 0xb4, 0xcd}, "11233QC4"},
+		{[]byte{0x00}, "1"},
+	}
+
+	for _, test := range tests {
+		if got := string(Base58Encode(test.input)); got != test.encoded {
+			t.Fatalf("Base58Encode(%x) = %s, want %s", test.input, got, test.encoded)
+		}
+		if got := Base58Decode([]byte(test.encoded)); !bytes.Equal(got, test.input) {
+			t.Fatalf("Base58Decode(%s) = %x, want %x", test.encoded, got, test.input)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// 规范二进制编码：整数按固定长度的大端序写入，字节串和列表前面写入4字节的长度。
+// 同样的数据总是得到同样的字节，其他语言也可以按同样的规则重现交易ID和区块哈希
+
+// ErrShortData 表示数据在读完之前就结束了
+var ErrShortData = errors.New("codec: unexpected end of data")
+
+// ErrTrailingData 表示读完之后还有多余的数据
+var ErrTrailingData = errors.New("codec: trailing data")
+
+// ErrInvalidBool 表示布尔值的字节既不是0也不是1
+var ErrInvalidBool = errors.New("codec: invalid boolean")
+
+// Encoder 按规范二进制编码写入数据
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *Encoder) WriteUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *Encoder) WriteInt64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.buf.Write(b[:])
+}
+
+// WriteBool 写入1个字节，真为1，假为0
+func (e *Encoder) WriteBool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+// WriteBytes 写入4字节的长度和字节串本身，nil和空字节串的编码相同
+func (e *Encoder) WriteBytes(data []byte) {
+	e.WriteUint32(uint32(len(data)))
+	e.buf.Write(data)
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Decoder 读取Encoder写入的数据。出错后的读取都返回零值，错误由Err或Finish返回
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = ErrShortData
+		return nil
+	}
+
+	b := d.data[:n]
+	d.data = d.data[n:]
+
+	return b
+}
+
+func (d *Decoder) ReadUint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *Decoder) ReadInt64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// ReadBool 读取WriteBool写入的布尔值，只接受0和1
+func (d *Decoder) ReadBool() bool {
+	b := d.next(1)
+	if b == nil {
+		return false
+	}
+	if b[0] > 1 {
+		d.err = ErrInvalidBool
+		return false
+	}
+
+	return b[0] == 1
+}
+
+// ReadBytes 读取带长度的字节串，长度为0时返回nil。返回的字节串是复制出来的
+func (d *Decoder) ReadBytes() []byte {
+	n := d.ReadUint32()
+	b := d.next(int(n))
+	if len(b) == 0 {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
+
+// ReadCount 读取列表的长度。每个元素至少占minSize个字节，长度超过剩余数据能容纳的数量时出错，
+// 避免按伪造的长度分配内存
+func (d *Decoder) ReadCount(minSize int) int {
+	n := int(d.ReadUint32())
+	if d.err == nil && minSize > 0 && n > len(d.data)/minSize {
+		d.err = ErrShortData
+		return 0
+	}
+
+	return n
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish 在读完所有数据后调用，返回读取中的错误，或者多余数据的错误
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.err = ErrTrailingData
+	}
+
+	return d.err
+}
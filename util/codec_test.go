@@ -0,0 +1,94 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	var e Encoder
+	e.WriteUint32(0xdeadbeef)
+	e.WriteInt64(-42)
+	e.WriteBytes([]byte("hello"))
+	e.WriteBytes(nil)
+	e.WriteBool(true)
+	e.WriteBool(false)
+
+	d := NewDecoder(e.Bytes())
+	if v := d.ReadUint32(); v != 0xdeadbeef {
+		t.Errorf("ReadUint32() = %x", v)
+	}
+	if v := d.ReadInt64(); v != -42 {
+		t.Errorf("ReadInt64() = %d", v)
+	}
+	if v := d.ReadBytes(); !bytes.Equal(v, []byte("hello")) {
+		t.Errorf("ReadBytes() = %q", v)
+	}
+	if v := d.ReadBytes(); v != nil {
+		t.Errorf("ReadBytes() = %q, want nil", v)
+	}
+	if !d.ReadBool() || d.ReadBool() {
+		t.Error("ReadBool() did not return true, false")
+	}
+	if err := d.Finish(); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+}
+
+func TestCodecBigEndian(t *testing.T) {
+	var e Encoder
+	e.WriteUint32(1)
+	e.WriteBytes([]byte{0xab})
+
+	want := []byte{0, 0, 0, 1, 0, 0, 0, 1, 0xab}
+	if !bytes.Equal(e.Bytes(), want) {
+		t.Fatalf("encoding = %x, want %x", e.Bytes(), want)
+	}
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	var e Encoder
+	e.WriteInt64(7)
+	e.WriteBytes([]byte("payload"))
+	data := e.Bytes()
+
+	for n := 0; n < len(data); n++ {
+		d := NewDecoder(data[:n])
+		d.ReadInt64()
+		d.ReadBytes()
+		if err := d.Finish(); !errors.Is(err, ErrShortData) {
+			t.Fatalf("%d bytes: Finish() = %v, want %v", n, err, ErrShortData)
+		}
+	}
+}
+
+func TestDecoderTrailingData(t *testing.T) {
+	d := NewDecoder([]byte{0, 0, 0, 1, 0xff})
+	d.ReadUint32()
+	if err := d.Finish(); !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("Finish() = %v, want %v", err, ErrTrailingData)
+	}
+}
+
+func TestDecoderOversizedLength(t *testing.T) {
+	// 长度超过剩余数据的字节串
+	d := NewDecoder([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3})
+	if v := d.ReadBytes(); v != nil || !errors.Is(d.Err(), ErrShortData) {
+		t.Fatalf("ReadBytes() = %x, err %v", v, d.Err())
+	}
+
+	// 列表长度超过剩余数据能容纳的元素个数
+	d = NewDecoder([]byte{0, 0, 0, 3, 1, 2, 3, 4, 5})
+	if n := d.ReadCount(4); n != 0 || !errors.Is(d.Err(), ErrShortData) {
+		t.Fatalf("ReadCount() = %d, err %v", n, d.Err())
+	}
+}
+
+func TestDecoderInvalidBool(t *testing.T) {
+	d := NewDecoder([]byte{2})
+	d.ReadBool()
+	if err := d.Finish(); !errors.Is(err, ErrInvalidBool) {
+		t.Fatalf("Finish() = %v, want %v", err, ErrInvalidBool)
+	}
+}
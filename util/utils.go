@@ -2,8 +2,11 @@ package util
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"log"
+
+	"golang.org/x/crypto/ripemd160"
 )
 
 // IntToHex converts an int64 to a byte array
@@ -22,4 +25,17 @@ func ReverseBytes(data []byte) {
 	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
 		data[i], data[j] = data[j], data[i]
 	}
-}
\ No newline at end of file
+}
+
+// Hash160 计算RIPEMD160(SHA256(data))，用于公钥哈希和脚本哈希
+func Hash160(data []byte) []byte {
+	publicSHA256 := sha256.Sum256(data)
+
+	RIPEMD160Hasher := ripemd160.New()
+	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return RIPEMD160Hasher.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"blockchain/script"
+	"blockchain/transaction"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 哈希时间锁定合约（HTLC）：付款人把币锁定在合约的P2SH地址上，收款人出示秘密即可领取，超时后付款人可以取回。
+// 两条链上使用同一个秘密哈希的两个合约组成原子交换：发起方领取对方的币时公开了秘密，对方再用这个秘密领取发起方的币。
+// 发起方的合约超时时间应该更长，保证对方看到秘密后还有时间领取
+
+// NewSecret creates a random HTLC secret and its hash
+// 生成随机的秘密和它的SHA-256哈希，哈希写入合约，秘密由发起方保存到领取时才公开
+func NewSecret() ([]byte, []byte) {
+	secret := make([]byte, script.SecretSize)
+	_, err := rand.Read(secret)
+	if err != nil {
+		log.Panic(err)
+	}
+	hash := sha256.Sum256(secret)
+
+	return secret, hash[:]
+}
+
+// CreateHTLC adds an HTLC address to Wallets
+// 创建合约：recipient出示哈希为secretHash的秘密即可领取，lockTime之后refund可以取回。记录合约的赎回脚本，返回它的地址
+func (ws *Wallets) CreateHTLC(secretHash []byte, recipient, refund string, lockTime uint32) (string, error) {
+	if len(secretHash) != sha256.Size {
+		return "", errors.New("ERROR: Secret hash must be a SHA-256 hash")
+	}
+	recipientHash, err := pubKeyHashOf(recipient)
+	if err != nil {
+		return "", err
+	}
+	refundHash, err := pubKeyHashOf(refund)
+	if err != nil {
+		return "", err
+	}
+
+	redeemScript := script.HTLC{SecretHash: secretHash, RecipientHash: recipientHash, RefundHash: refundHash, LockTime: lockTime}.Script()
+	address := string(ScriptHashAddress(redeemScript))
+
+	ws.HTLCs[address] = redeemScript
+
+	return address, nil
+}
+
+// RedeemHTLC signs tx to claim an HTLC with the secret
+// 收款人用秘密签名领取合约的交易，交易由core.NewHTLCTransaction构造
+func (w Wallet) RedeemHTLC(tx *transaction.Transaction, redeemScript script.Script, secret []byte) error {
+	if secret == nil {
+		return errors.New("ERROR: Secret is required to redeem an HTLC")
+	}
+
+	return tx.SignHTLC(w.PrivateKey, redeemScript, secret)
+}
+
+// RefundHTLC signs tx to take back an HTLC after it timed out
+// 付款人在超时后签名取回合约的交易，交易的锁定时间必须是合约的超时时间
+func (w Wallet) RefundHTLC(tx *transaction.Transaction, redeemScript script.Script) error {
+	return tx.SignHTLC(w.PrivateKey, redeemScript, nil)
+}
+
+// FindHTLCSecret returns the secret revealed by a transaction claiming an HTLC
+// 在领取合约的交易中找到收款人公开的秘密
+func FindHTLCSecret(tx *transaction.Transaction) ([]byte, bool) {
+	for _, vin := range tx.Vin {
+		if secret, ok := script.ExtractHTLCSecret(vin.ScriptSig); ok {
+			return secret, true
+		}
+	}
+
+	return nil, false
+}
+
+// 普通地址中的公钥哈希
+func pubKeyHashOf(address string) ([]byte, error) {
+	if !ValidateAddress(address) {
+		return nil, fmt.Errorf("ERROR: Address %s is not valid", address)
+	}
+	lockingScript, err := script.PayToAddress([]byte(address))
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash, ok := script.ExtractPubKeyHash(lockingScript)
+	if !ok {
+		return nil, fmt.Errorf("ERROR: Address %s is not a public key hash address", address)
+	}
+
+	return pubKeyHash, nil
+}
@@ -0,0 +1,166 @@
+package wallet_test
+
+import (
+	"blockchain/core"
+	"blockchain/script"
+	"blockchain/transaction"
+	"blockchain/wallet"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	core.TargetBits = 8
+	core.CoinbaseMaturity = 0
+
+	os.Exit(m.Run())
+}
+
+// 一条独立的链和它的创世区块奖励的所有者
+type swapParty struct {
+	w       *wallet.Wallet
+	address string
+	ws      *wallet.Wallets
+	bc      *core.Blockchain
+	utxo    *core.UTXOSet
+}
+
+func newSwapParty() *swapParty {
+	w := wallet.NewWallet()
+	address := fmt.Sprintf("%s", w.GetAddress())
+	bc := core.CreateBlockchainWithStore(address, core.NewMemoryStore())
+	ws := &wallet.Wallets{Wallets: map[string]*wallet.Wallet{address: w}, MultiSigs: map[string]script.Script{}, HTLCs: map[string]script.Script{}}
+
+	return &swapParty{w, address, ws, bc, &core.UTXOSet{Blockchain: bc}}
+}
+
+// 在自己的链上挖一个包含txs的区块，返回挖出的区块
+func (p *swapParty) mine(t *testing.T, txs ...*transaction.Transaction) *core.Block {
+	t.Helper()
+
+	for _, tx := range txs {
+		if !p.bc.VerifyTransaction(tx) {
+			t.Fatalf("transaction %x is invalid", tx.ID)
+		}
+	}
+	block := p.bc.MineBlock(p.bc.NewBlockTemplate(txs, p.address))
+	if len(block.Transactions) != len(txs)+1 {
+		t.Fatalf("block has %d transactions, want %d", len(block.Transactions), len(txs)+1)
+	}
+
+	return block
+}
+
+// 在自己的链上把amount个币锁定在HTLC中，返回合约的赎回脚本
+func (p *swapParty) lock(t *testing.T, secretHash []byte, recipient string, amount int, lockTime uint32) script.Script {
+	t.Helper()
+
+	htlc, err := p.ws.CreateHTLC(secretHash, recipient, p.address, lockTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeemScript, ok := p.ws.GetRedeemScript(htlc)
+	if !ok {
+		t.Fatal("HTLC is not in the wallet")
+	}
+	p.mine(t, core.NewUTXOTransaction(p.w, htlc, amount, 0, 0, nil, p.utxo))
+
+	if balance, _ := p.utxo.GetBalance(wallet.HashPubKey(p.w.PublicKey)); balance == 0 {
+		t.Fatal("funding transaction paid no change")
+	}
+
+	return redeemScript
+}
+
+func (p *swapParty) balance(w *wallet.Wallet) int {
+	balance, _ := p.utxo.GetBalance(wallet.HashPubKey(w.PublicKey))
+
+	return balance
+}
+
+func TestAtomicSwap(t *testing.T) {
+	alice, bob := newSwapParty(), newSwapParty()
+	secret, secretHash := wallet.NewSecret()
+
+	// Alice发起，在A链上锁定5个币给Bob；Bob在B链上用同一个秘密哈希锁定3个币给Alice，超时时间更短
+	redeemA := alice.lock(t, secretHash, bob.address, 5, uint32(alice.bc.GetBestHeight()+10))
+	h, ok := script.ExtractHTLC(redeemA)
+	if !ok || !bytes.Equal(h.SecretHash, secretHash) {
+		t.Fatal("Bob cannot read Alice's contract")
+	}
+	redeemB := bob.lock(t, h.SecretHash, alice.address, 3, uint32(bob.bc.GetBestHeight()+5))
+
+	// 秘密不对时不能领取
+	wrong := core.NewHTLCTransaction(redeemB, alice.address, 3, 0, false, bob.utxo)
+	if err := alice.w.RedeemHTLC(wrong, redeemB, make([]byte, script.SecretSize)); err != nil {
+		t.Fatal(err)
+	}
+	if bob.bc.VerifyTransaction(wrong) {
+		t.Fatal("HTLC redeemed with a wrong secret")
+	}
+
+	// Alice在B链上用秘密领取，秘密随之公开
+	claimB := core.NewHTLCTransaction(redeemB, alice.address, 3, 0, false, bob.utxo)
+	if err := alice.w.RedeemHTLC(claimB, redeemB, secret); err != nil {
+		t.Fatal(err)
+	}
+	block := bob.mine(t, claimB)
+
+	// Bob从B链的区块中找到秘密，在A链上领取
+	revealed, ok := wallet.FindHTLCSecret(block.Transactions[1])
+	if !ok || !bytes.Equal(revealed, secret) {
+		t.Fatal("secret is not revealed by the claim")
+	}
+	claimA := core.NewHTLCTransaction(redeemA, bob.address, 5, 0, false, alice.utxo)
+	if err := bob.w.RedeemHTLC(claimA, redeemA, revealed); err != nil {
+		t.Fatal(err)
+	}
+	alice.mine(t, claimA)
+
+	if got := alice.balance(bob.w); got != 5 {
+		t.Fatalf("Bob has %d on chain A, want 5", got)
+	}
+	if got := bob.balance(alice.w); got != 3 {
+		t.Fatalf("Alice has %d on chain B, want 3", got)
+	}
+}
+
+func TestHTLCRefundAfterLockTime(t *testing.T) {
+	alice, bob := newSwapParty(), newSwapParty()
+	_, secretHash := wallet.NewSecret()
+
+	lockTime := uint32(alice.bc.GetBestHeight() + 3)
+	redeemScript := alice.lock(t, secretHash, bob.address, 4, lockTime)
+
+	// 收款人不能走退款分支
+	refund := core.NewHTLCTransaction(redeemScript, alice.address, 4, 0, true, alice.utxo)
+	if err := bob.w.RefundHTLC(refund, redeemScript); err == nil {
+		t.Fatal("recipient signed the refund branch")
+	}
+	if err := alice.w.RefundHTLC(refund, redeemScript); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超时之前退款交易不能打包
+	for alice.bc.GetBestHeight()+1 <= int(lockTime) {
+		if err := alice.bc.CheckTransactionLocks(refund); !errors.Is(err, core.ErrNonFinalTx) {
+			t.Fatalf("CheckTransactionLocks() at height %d = %v, want %v", alice.bc.GetBestHeight()+1, err, core.ErrNonFinalTx)
+		}
+		alice.mine(t)
+	}
+
+	if err := alice.bc.CheckTransactionLocks(refund); err != nil {
+		t.Fatal(err)
+	}
+	before := alice.balance(alice.w)
+	block := alice.mine(t, refund)
+
+	// 打包退款交易的区块的奖励也发给了Alice
+	want := before + 4 + transaction.BlockSubsidy(block.Height)
+	if got := alice.balance(alice.w); got != want {
+		t.Fatalf("Alice has %d after refund, want %d", got, want)
+	}
+}
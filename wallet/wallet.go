@@ -5,13 +5,15 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"log"
+	"blockchain/script"
+	"blockchain/transaction"
 	"blockchain/util"
 	"crypto/sha256"
-	"golang.org/x/crypto/ripemd160"
 	"bytes"
 )
 
-const version = byte(0x00)
+// 普通地址（公钥哈希）的版本号
+const version = script.PubKeyHashAddrVersion
 const addressChecksumLen = 4
 
 // Wallet stores private and public keys
@@ -39,7 +41,7 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 		log.Panic(err)
 	}
 	// 公钥是椭圆曲线上的点，由X、Y坐标组成。相关数据从私钥中取出
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	pubKey := transaction.PubKeyBytes(private.PublicKey)
 
 	return *private, pubKey
 }
@@ -48,41 +50,46 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 func (w Wallet) GetAddress() []byte {
 	// 对钱包公钥进行哈希计算，获取公钥哈希
 	pubKeyHash := HashPubKey(w.PublicKey)
-	// 这里的版本号version是自定义的
-	versionedPayload := append([]byte{version}, pubKeyHash...)
+
+	return encodeAddress(version, pubKeyHash)
+}
+
+// 根据多重签名等赎回脚本生成脚本哈希地址，使用单独的版本号，发往这个地址的输出使用P2SH锁定脚本
+func ScriptHashAddress(redeemScript script.Script) []byte {
+	return encodeAddress(script.ScriptHashAddrVersion, util.Hash160(redeemScript))
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	// 版本号决定了地址的类型
+	versionedPayload := append([]byte{version}, hash...)
 	//checksum由versionedPayload经过两次sha256算法计算得出
 	checksum := checksum(versionedPayload)
 	fullPayload := append(versionedPayload, checksum...)
-	// 地址由 版本号version + 公钥哈希pubKeyHash + checksum 三部分，通过Base58算法计算得出
+	// 地址由 版本号version + 哈希 + checksum 三部分，通过Base58算法计算得出
 	address := util.Base58Encode(fullPayload)
 
 	return address
 }
 
-// 对钱包公钥进行哈希计算，获取公钥哈希
+// 对钱包公钥进行哈希计算，获取公钥哈希：先进行一次sha256计算，再进行一次ripemd160计算
 func HashPubKey(pubKey []byte) []byte {
-	// 首先对公钥进行一次sha256计算，
-	publicSHA256 := sha256.Sum256(pubKey)
-	// 之后再进行一次ripemd160计算，
-	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
-	if err != nil {
-		log.Panic(err)
-	}
-	// 最后将结果转为[]byte输出
-	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
-
-	return publicRIPEMD160
+	return util.Hash160(pubKey)
 }
 
 // 检查地址是否有效
 func ValidateAddress(address string) bool {
 	// 首先对传入的地址进行解码
 	pubKeyHash := util.Base58Decode([]byte(address))
+	if len(pubKeyHash) <= 1+addressChecksumLen {
+		return false
+	}
 	// Checksum在最后，占4个字节。因此我们取出后4个字节的数据actualChecksum
 	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	// version占1个字节
+	// version占1个字节，只支持普通地址和脚本哈希地址
 	version := pubKeyHash[0]
+	if version != script.PubKeyHashAddrVersion && version != script.ScriptHashAddrVersion {
+		return false
+	}
 	// 剩下的就是该地址的公钥哈希
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
 	// 如果一个地址有效，
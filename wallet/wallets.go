@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"blockchain/script"
 	"bytes"
 	"crypto/elliptic"
 	"encoding/gob"
@@ -10,19 +11,28 @@ import (
 	"os"
 )
 
-const walletFile = "wallet.dat"
+// 每个节点使用自己的钱包文件。以前所有节点共用wallet.dat，节点自己的文件不存在时从这个文件加载，
+// 保存时写入节点自己的文件
+const walletFile = "wallet_%s.dat"
+const legacyWalletFile = "wallet.dat"
 
 // Wallet stores private and public keys
 // 用Wallets来记录所有用户创建的所有钱包：一个钱包地址对应一个钱包
 type Wallets struct {
 	Wallets map[string]*Wallet
+	// 多重签名地址 -> 赎回脚本，花费这些地址的输出时需要赎回脚本
+	MultiSigs map[string]script.Script
+	// HTLC地址 -> 合约的赎回脚本
+	HTLCs map[string]script.Script
 }
 
 // NewWallets creates Wallets and fills it from a file if it exists
-// 我们会把所有的钱包信息存入wallet.dat文件中，创建新的Wallets时从文件中加载即可。
+// 我们会把所有的钱包信息存入wallet_<节点ID>.dat文件中，创建新的Wallets时从文件中加载即可。
 func NewWallets(nodeID string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.MultiSigs = make(map[string]script.Script)
+	wallets.HTLCs = make(map[string]script.Script)
 	// 
 	err := wallets.LoadFromFile(nodeID)
 
@@ -40,6 +50,51 @@ func (ws *Wallets) CreateWallet() string {
 	return address
 }
 
+// CreateMultiSig adds an m-of-n multisig address to Wallets
+// 用pubKeys创建m-of-n多重签名地址，记录它的赎回脚本。公钥的顺序不同，得到的地址也不同
+func (ws *Wallets) CreateMultiSig(m int, pubKeys [][]byte) (string, error) {
+	redeemScript, err := script.MultiSig(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	address := string(ScriptHashAddress(redeemScript))
+
+	ws.MultiSigs[address] = redeemScript
+
+	return address, nil
+}
+
+// GetRedeemScript returns the redeem script of a multisig or HTLC address
+func (ws Wallets) GetRedeemScript(address string) (script.Script, bool) {
+	if redeemScript, ok := ws.MultiSigs[address]; ok {
+		return redeemScript, true
+	}
+	redeemScript, ok := ws.HTLCs[address]
+
+	return redeemScript, ok
+}
+
+// GetMultiSigSigners returns the wallets that hold keys of a multisig address
+// 返回持有多重签名地址中的公钥的钱包
+func (ws Wallets) GetMultiSigSigners(address string) []*Wallet {
+	var signers []*Wallet
+
+	_, pubKeys, ok := script.ExtractMultiSig(ws.MultiSigs[address])
+	if !ok {
+		return nil
+	}
+
+	for _, pubKey := range pubKeys {
+		for _, wallet := range ws.Wallets {
+			if bytes.Compare(wallet.PublicKey, pubKey) == 0 {
+				signers = append(signers, wallet)
+			}
+		}
+	}
+
+	return signers
+}
+
 // GetAddresses returns an array of addresses stored in the wallet file
 // 获取所有钱包的地址
 func (ws *Wallets) GetAddresses() []string {
@@ -63,7 +118,10 @@ func (ws *Wallets) LoadFromFile(nodeID string) error {
 	walletFile := fmt.Sprintf(walletFile, nodeID)
 	// 对文件是否存在进行校验
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		return err
+		if _, legacyErr := os.Stat(legacyWalletFile); legacyErr != nil {
+			return err
+		}
+		walletFile = legacyWalletFile
 	}
 
 	fileContent, err := ioutil.ReadFile(walletFile)
@@ -81,6 +139,12 @@ func (ws *Wallets) LoadFromFile(nodeID string) error {
 	}
 
 	ws.Wallets = wallets.Wallets
+	if wallets.MultiSigs != nil {
+		ws.MultiSigs = wallets.MultiSigs
+	}
+	if wallets.HTLCs != nil {
+		ws.HTLCs = wallets.HTLCs
+	}
 
 	return nil
 }